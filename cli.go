@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/syepes/network_exporter/config"
+	"github.com/syepes/network_exporter/pkg/common"
+	"github.com/syepes/network_exporter/pkg/http"
+	"github.com/syepes/network_exporter/pkg/mtr"
+	"github.com/syepes/network_exporter/pkg/ping"
+	"github.com/syepes/network_exporter/pkg/tcp"
+)
+
+// One-shot checks executed with the same engine as the exporter
+// The settings that are not specified are taken from the configuration file (icmp, mtr, tcp and http_get sections) or the defaults
+var (
+	serveCmd = kingpin.Command("serve", "Run the exporter (default)").Default()
+
+	pingCmd         = kingpin.Command("ping", "Ping a host")
+	pingHost        = pingCmd.Arg("host", "Hostname or IP").Required().String()
+	pingCount       = pingCmd.Flag("count", "Number of pings (default: icmp.count)").Int()
+	pingTimeout     = pingCmd.Flag("timeout", "Timeout of each ping (default: icmp.timeout)").Duration()
+	pingPayloadSize = pingCmd.Flag("payload-size", "ICMP payload size in bytes (default: icmp.payload_size)").Int()
+	pingSourceIp    = pingCmd.Flag("source-ip", "Source IP").String()
+	pingJSON        = pingCmd.Flag("json", "JSON output").Bool()
+
+	mtrCmd         = kingpin.Command("mtr", "Traceroute a host")
+	mtrHost        = mtrCmd.Arg("host", "Hostname or IP, host:port for the TCP and UDP protocols").Required().String()
+	mtrProtocol    = mtrCmd.Flag("protocol", "Protocol: icmp, tcp or udp (default: mtr.protocol)").Enum("icmp", "tcp", "udp")
+	mtrMaxHops     = mtrCmd.Flag("max-hops", "Maximum number of hops (default: mtr.max-hops)").Int()
+	mtrCount       = mtrCmd.Flag("count", "Number of rounds (default: mtr.count)").Int()
+	mtrTimeout     = mtrCmd.Flag("timeout", "Timeout of each probe (default: mtr.timeout)").Duration()
+	mtrPayloadSize = mtrCmd.Flag("payload-size", "ICMP / UDP payload size in bytes (default: mtr.payload_size)").Int()
+	mtrParallel    = mtrCmd.Flag("parallel", "Number of TTLs probed at the same time (default: mtr.parallel)").Int()
+	mtrUdpParis    = mtrCmd.Flag("udp-paris", "Fixed UDP ports for every probe (default: mtr.udp_paris)").IsSetByUser(&mtrUdpParisSet).Bool()
+	mtrSourceIp    = mtrCmd.Flag("source-ip", "Source IP").String()
+	mtrJSON        = mtrCmd.Flag("json", "JSON output").Bool()
+
+	tcpCmd      = kingpin.Command("tcp", "Connect to a TCP port")
+	tcpHost     = tcpCmd.Arg("host", "host:port, the port can be a list or range (22,80,8000-8010)").Required().String()
+	tcpCount    = tcpCmd.Flag("count", "Number of connects (default: tcp.count)").Int()
+	tcpTimeout  = tcpCmd.Flag("timeout", "Timeout of each connect (default: tcp.timeout)").Duration()
+	tcpExpect   = tcpCmd.Flag("expect", "Expected port state").Default("open").Enum("open", "closed", "filtered")
+	tcpSourceIp = tcpCmd.Flag("source-ip", "Source IP").String()
+	tcpJSON     = tcpCmd.Flag("json", "JSON output").Bool()
+
+	httpCmd             = kingpin.Command("http", "HTTP Get an URL")
+	httpURL             = httpCmd.Arg("url", "URL").Required().String()
+	httpTimeout         = httpCmd.Flag("timeout", "Request timeout (default: http_get.timeout)").Duration()
+	httpVersion         = httpCmd.Flag("http-version", "HTTP version: 1.1, 2 or 3 (default: negotiated)").Enum("1.1", "2", "3")
+	httpFollowRedirects = httpCmd.Flag("follow-redirects", "Follow redirects").Default("true").Bool()
+	httpMaxRedirects    = httpCmd.Flag("max-redirects", "Maximum number of redirects to follow").Default("10").Int()
+	httpProxy           = httpCmd.Flag("proxy", "Proxy URL (http, https, socks5 or socks5h)").String()
+	httpSourceIp        = httpCmd.Flag("source-ip", "Source IP").String()
+	httpJSON            = httpCmd.Flag("json", "JSON output").Bool()
+
+	checkConfigCmd  = kingpin.Command("check-config", "Validate a configuration file")
+	checkConfigFile = checkConfigCmd.Arg("file", "Configuration file (default: --config.file)").String()
+
+	// configFileSet The configuration file was given with --config.file, the commands fail if it can't be loaded
+	configFileSet bool
+	// mtrUdpParisSet --udp-paris or --no-udp-paris was given, it overrides mtr.udp_paris
+	mtrUdpParisSet bool
+)
+
+// runCommand executes a one-shot check and returns the exit code (0: success, 1: failed check, 2: error)
+func runCommand(command string) int {
+	if command == checkConfigCmd.FullCommand() {
+		return runCheckConfigCommand()
+	}
+
+	// Without --config.file the default configuration file is optional, the default settings are used if it doesn't exist
+	if _, err := os.Stat(*configFile); !configFileSet && os.IsNotExist(err) {
+		logger.Debug("Using the default settings", "func", "runCommand", "file", *configFile)
+		cfg, err := config.Default()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		sc.Cfg = cfg
+	} else {
+		// Only the protocol settings are used, the targets and server settings (http_sd, mesh, cluster, probes) are not loaded
+		cfg, err := config.Load(logger, *configFile, *configFileHeaders)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: loading %s: %v\n", *configFile, err)
+			return 2
+		}
+		sc.Cfg = cfg
+	}
+
+	var success bool
+	var err error
+	switch command {
+	case pingCmd.FullCommand():
+		success, err = runPingCommand(sc.Cfg)
+	case mtrCmd.FullCommand():
+		success, err = runMtrCommand(sc.Cfg)
+	case tcpCmd.FullCommand():
+		success, err = runTCPCommand(sc.Cfg)
+	case httpCmd.FullCommand():
+		success, err = runHTTPCommand(sc.Cfg)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if !success {
+		return 1
+	}
+	return 0
+}
+
+// runCheckConfigCommand validates the configuration file strictly and prints every problem found
+func runCheckConfigCommand() int {
+	file := *configFile
+	if *checkConfigFile != "" {
+		file = *checkConfigFile
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	errs := config.Check(file, data)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+		}
+		return 1
+	}
+	fmt.Printf("%s: OK\n", file)
+	return 0
+}
+
+func runPingCommand(cfg *config.Config) (bool, error) {
+	ip, err := resolveHost(*pingHost)
+	if err != nil {
+		return false, err
+	}
+
+	count := intOrDefault(*pingCount, cfg.ICMP.Count)
+	timeout := durationOrDefault(*pingTimeout, cfg.ICMP.Timeout.Duration())
+	payloadSize := intOrDefault(*pingPayloadSize, cfg.ICMP.PayloadSize)
+	if err := config.CheckPayloadSize(payloadSize); err != nil {
+		return false, fmt.Errorf("payload-size %s", err)
+	}
+
+	if *pingJSON {
+		result, err := ping.Ping(*pingHost, ip, *pingSourceIp, count, timeout, int(icmpID.Get()), payloadSize, *enableIpv6)
+		if err != nil {
+			return false, err
+		}
+		return result.Success, printJSON(result)
+	}
+
+	result, err := ping.PingString(*pingHost, ip, *pingSourceIp, count, timeout, int(icmpID.Get()), payloadSize, *enableIpv6)
+	fmt.Print(result)
+	return err == nil, nil
+}
+
+func runMtrCommand(cfg *config.Config) (bool, error) {
+	protocol := *mtrProtocol
+	if protocol == "" {
+		protocol = cfg.MTR.Protocol
+	}
+
+	// Port from host if specified (for TCP and UDP protocol)
+	host := *mtrHost
+	port := cfg.MTR.TcpPort
+	if protocol == "udp" {
+		port = cfg.MTR.UdpPort
+	}
+	if (protocol == "tcp" || protocol == "udp") && strings.Count(host, ":") == 1 {
+		host, port, _ = strings.Cut(host, ":")
+	}
+
+	ip, err := resolveHost(host)
+	if err != nil {
+		return false, err
+	}
+
+	maxHops := intOrDefault(*mtrMaxHops, cfg.MTR.MaxHops)
+	count := intOrDefault(*mtrCount, cfg.MTR.Count)
+	timeout := durationOrDefault(*mtrTimeout, cfg.MTR.Timeout.Duration())
+	payloadSize := intOrDefault(*mtrPayloadSize, cfg.MTR.PayloadSize)
+	if err := config.CheckPayloadSize(payloadSize); err != nil {
+		return false, fmt.Errorf("payload-size %s", err)
+	}
+	parallel := intOrDefault(*mtrParallel, cfg.MTR.Parallel)
+	udpParis := cfg.MTR.UdpParis
+	if mtrUdpParisSet {
+		udpParis = *mtrUdpParis
+	}
+
+	if *mtrJSON {
+		result, err := mtr.Mtr(ip, *mtrSourceIp, maxHops, count, timeout, int(icmpID.Get()), payloadSize, protocol, port, udpParis, parallel, *enableIpv6)
+		if err != nil {
+			return false, err
+		}
+		return true, printJSON(result)
+	}
+
+	result, err := mtr.MtrString(ip, *mtrSourceIp, maxHops, count, timeout, int(icmpID.Get()), payloadSize, protocol, port, udpParis, parallel, *enableIpv6)
+	fmt.Print(result)
+	return err == nil, nil
+}
+
+func runTCPCommand(cfg *config.Config) (bool, error) {
+	host, portSpec, err := net.SplitHostPort(*tcpHost)
+	if err != nil {
+		return false, fmt.Errorf("could not identify host:port: %v", *tcpHost)
+	}
+	ports, err := common.ExpandPorts(portSpec)
+	if err != nil {
+		return false, err
+	}
+
+	ip, err := resolveHost(host)
+	if err != nil {
+		return false, err
+	}
+
+	count := intOrDefault(*tcpCount, cfg.TCP.Count)
+	timeout := durationOrDefault(*tcpTimeout, cfg.TCP.Timeout.Duration())
+
+	success := true
+	results := []*tcp.TCPPortReturn{}
+	for _, port := range ports {
+		result, err := tcp.Port(host, ip, *tcpSourceIp, port, *tcpExpect, count, timeout, nil)
+		if err != nil {
+			logger.Debug("TCP check failed", "func", "runTCPCommand", "host", host, "port", port, "err", err)
+		}
+		success = success && result.Success
+		results = append(results, result)
+	}
+
+	if *tcpJSON {
+		return success, printJSON(results)
+	}
+
+	for _, result := range results {
+		status := "OK"
+		if !result.Success {
+			status = "FAILED"
+		}
+		fmt.Printf("TCP %v:%v (%v) %v: %v, expected %v, time %vms, %v/%v failed, loss %.1f%%\n", result.DestAddr, result.DestPort, result.DestIp, status, result.State, *tcpExpect, common.Time2Float(result.ConTime), result.SntFailSummary, result.SntSummary, result.DropRate*100)
+	}
+	return success, nil
+}
+
+func runHTTPCommand(cfg *config.Config) (bool, error) {
+	timeout := durationOrDefault(*httpTimeout, cfg.HTTPGet.Timeout.Duration())
+	options := &http.HTTPOptions{
+		FollowRedirects: *httpFollowRedirects,
+		MaxRedirects:    *httpMaxRedirects,
+		HTTPVersion:     *httpVersion,
+	}
+	if *httpProxy != "" {
+		options.Proxy = &http.HTTPProxy{URL: *httpProxy, Resolver: getResolver().Resolver}
+	}
+
+	result, err := http.HTTPGet(*httpURL, *httpSourceIp, timeout, options)
+	if err != nil {
+		logger.Debug("HTTP check failed", "func", "runHTTPCommand", "url", *httpURL, "err", err)
+	}
+
+	if *httpJSON {
+		return result.Success, printJSON(result)
+	}
+
+	fmt.Printf("HTTP GET %v\n", result.DestAddr)
+	if err != nil {
+		fmt.Printf("Failed due to an error: %v\n", err)
+	}
+	fmt.Printf("Status: %v %v, Content: %v bytes, Redirects: %v\n", result.Status, result.Protocol, result.ContentLength, len(result.Redirects))
+	for hop, redirect := range result.Redirects {
+		fmt.Printf("  %d: %v %v -> %v (%vms)\n", hop+1, redirect.Status, redirect.URL, redirect.Location, common.Time2Float(redirect.Elapsed))
+	}
+	if result.TLSVersion != "" {
+		fmt.Printf("TLS: %v, Certificate expiry: %v\n", result.TLSVersion, result.TLSEarliestCertExpiry.Format(time.RFC3339))
+	}
+	fmt.Printf("DNSLookup: %vms, TCPConnection: %vms, ProxyConnect: %vms, TLSHandshake: %vms, ServerProcessing: %vms, ContentTransfer: %vms, Total: %vms\n",
+		common.Time2Float(result.DNSLookup), common.Time2Float(result.TCPConnection), common.Time2Float(result.ProxyConnect), common.Time2Float(result.TLSHandshake),
+		common.Time2Float(result.ServerProcessing), common.Time2Float(result.ContentTransfer), common.Time2Float(result.Total))
+	return result.Success, nil
+}
+
+// resolveHost resolves the host with the configured resolver and returns its first IP
+func resolveHost(host string) (string, error) {
+	resolver := getResolver()
+	ipAddrs, err := common.DestAddrs(context.Background(), host, resolver.Resolver, resolver.Timeout, *enableIpv6)
+	if err != nil {
+		return "", err
+	}
+	if len(ipAddrs) == 0 {
+		return "", fmt.Errorf("no IP address found for: %v", host)
+	}
+	return ipAddrs[0], nil
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func intOrDefault(v int, def int) int {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+func durationOrDefault(v time.Duration, def time.Duration) time.Duration {
+	if v == 0 {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/syepes/network_exporter/config"
+)
+
+var (
+	sdRefreshFailuresDesc     = prometheus.NewDesc("sd_refresh_failures_total", "Number of failed service discovery refreshes", []string{"mechanism"}, nil)
+	configReloadSuccessDesc   = prometheus.NewDesc("network_exporter_config_last_reload_successful", "Whether the last configuration reload attempt was successful", nil, nil)
+	configReloadTimestampDesc = prometheus.NewDesc("network_exporter_config_last_reload_success_timestamp_seconds", "Timestamp of the last successful configuration reload", nil, nil)
+	configReloadTotalDesc     = prometheus.NewDesc("network_exporter_config_reload_total", "Number of configuration reloads", []string{"result"}, nil)
+	configHashDesc            = prometheus.NewDesc("network_exporter_config_hash", "Hash of the loaded configuration", nil, nil)
+	clusterPeerUpDesc         = prometheus.NewDesc("network_exporter_cluster_peer_up", "Whether the cluster peer is alive", []string{"peer", "instance", "self"}, nil)
+)
+
+// Config prom
+type Config struct {
+	Config *config.SafeConfig
+}
+
+// Describe prom
+func (p *Config) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sdRefreshFailuresDesc
+	ch <- configReloadSuccessDesc
+	ch <- configReloadTimestampDesc
+	ch <- configReloadTotalDesc
+	ch <- configHashDesc
+	ch <- clusterPeerUpDesc
+}
+
+// Collect prom
+func (p *Config) Collect(ch chan<- prometheus.Metric) {
+	success, successTime := p.Config.LastReload()
+	if success {
+		ch <- prometheus.MustNewConstMetric(configReloadSuccessDesc, prometheus.GaugeValue, 1)
+	} else {
+		ch <- prometheus.MustNewConstMetric(configReloadSuccessDesc, prometheus.GaugeValue, 0)
+	}
+	if !successTime.IsZero() {
+		ch <- prometheus.MustNewConstMetric(configReloadTimestampDesc, prometheus.GaugeValue, float64(successTime.Unix()))
+		ch <- prometheus.MustNewConstMetric(configHashDesc, prometheus.GaugeValue, p.Config.Hash())
+	}
+	for result, total := range p.Config.ReloadTotal() {
+		ch <- prometheus.MustNewConstMetric(configReloadTotalDesc, prometheus.CounterValue, total, result)
+	}
+
+	for mechanism, failures := range p.Config.SDRefreshFailures() {
+		ch <- prometheus.MustNewConstMetric(sdRefreshFailuresDesc, prometheus.CounterValue, failures, mechanism)
+	}
+
+	if p.Config.Cluster != nil {
+		self := p.Config.Cluster.Self()
+		for addr, peer := range p.Config.Cluster.Peers() {
+			value := 0.0
+			if peer.Up {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(clusterPeerUpDesc, prometheus.GaugeValue, value, addr, peer.ID, strconv.FormatBool(peer.ID == self))
+		}
+	}
+}
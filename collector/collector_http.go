@@ -2,6 +2,7 @@ package collector
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -11,10 +12,13 @@ import (
 )
 
 var (
-	httpLabelNames  = []string{"name", "target"}
+	httpLabelNames  = []string{"name", "target", "target_ip"}
 	httpTimeDesc    = prometheus.NewDesc("http_get_seconds", "HTTP Get Drill Down time in seconds", append(httpLabelNames, "type"), nil)
 	httpSizeDesc    = prometheus.NewDesc("http_get_content_bytes", "HTTP Get Content Size in bytes", httpLabelNames, nil)
 	httpStatusDesc  = prometheus.NewDesc("http_get_status", "HTTP Get Status", httpLabelNames, nil)
+	httpProtoDesc   = prometheus.NewDesc("http_get_protocol_info", "HTTP Get Negotiated protocol", append(httpLabelNames, "protocol"), nil)
+	httpRedirDesc   = prometheus.NewDesc("http_get_redirects", "HTTP Get Number of followed redirects", append(httpLabelNames, "final_url"), nil)
+	httpRedirTDesc  = prometheus.NewDesc("http_get_redirect_seconds", "HTTP Get Redirect hop time in seconds", append(httpLabelNames, "hop", "url", "status"), nil)
 	httpTargetsDesc = prometheus.NewDesc("http_get_targets", "Number of active targets", nil, nil)
 	httpStateDesc   = prometheus.NewDesc("http_get_up", "Exporter state", nil, nil)
 	httpMutex       = &sync.Mutex{}
@@ -28,6 +32,9 @@ type httpDescriptorSet struct {
 	time   *prometheus.Desc
 	size   *prometheus.Desc
 	status *prometheus.Desc
+	proto  *prometheus.Desc
+	redir  *prometheus.Desc
+	redirT *prometheus.Desc
 }
 
 // getHTTPDescriptors returns cached or creates new descriptors for a label set
@@ -52,6 +59,9 @@ func getHTTPDescriptors(labels prometheus.Labels) *httpDescriptorSet {
 		time:   prometheus.NewDesc("http_get_seconds", "HTTP Get Drill Down time in seconds", append(httpLabelNames, "type"), labels),
 		size:   prometheus.NewDesc("http_get_content_bytes", "HTTP Get Content Size in bytes", httpLabelNames, labels),
 		status: prometheus.NewDesc("http_get_status", "HTTP Get Status", httpLabelNames, labels),
+		proto:  prometheus.NewDesc("http_get_protocol_info", "HTTP Get Negotiated protocol", append(httpLabelNames, "protocol"), labels),
+		redir:  prometheus.NewDesc("http_get_redirects", "HTTP Get Number of followed redirects", append(httpLabelNames, "final_url"), labels),
+		redirT: prometheus.NewDesc("http_get_redirect_seconds", "HTTP Get Redirect hop time in seconds", append(httpLabelNames, "hop", "url", "status"), labels),
 	}
 	httpDescCache[cacheKey] = descSet
 	return descSet
@@ -69,6 +79,9 @@ func (p *HTTPGet) Describe(ch chan<- *prometheus.Desc) {
 	ch <- httpTimeDesc
 	ch <- httpSizeDesc
 	ch <- httpStatusDesc
+	ch <- httpProtoDesc
+	ch <- httpRedirDesc
+	ch <- httpRedirTDesc
 	ch <- httpTargetsDesc
 	ch <- httpStateDesc
 }
@@ -95,8 +108,12 @@ func (p *HTTPGet) Collect(ch chan<- prometheus.Metric) {
 	targets := []string{}
 	for target, metric := range p.metrics {
 		targets = append(targets, target)
-		l := strings.SplitN(target, " ", 2)
-		l = append(l, metric.DestAddr)
+		// Targets of resolve_all are named "name ip"
+		name := target
+		if metric.DestIP != "" {
+			name = strings.TrimSuffix(target, " "+metric.DestIP)
+		}
+		l := []string{name, metric.DestAddr, metric.DestIP}
 		l2 := prometheus.Labels(p.labels[target])
 
 		// Get cached descriptors for this label set
@@ -104,13 +121,19 @@ func (p *HTTPGet) Collect(ch chan<- prometheus.Metric) {
 
 		if metric.Success {
 			ch <- prometheus.MustNewConstMetric(descs.status, prometheus.GaugeValue, float64(metric.Status), l...)
+			ch <- prometheus.MustNewConstMetric(descs.proto, prometheus.GaugeValue, 1, append(l, metric.Protocol)...)
 		} else {
 			ch <- prometheus.MustNewConstMetric(descs.status, prometheus.GaugeValue, 0, l...)
 		}
 
 		ch <- prometheus.MustNewConstMetric(descs.size, prometheus.GaugeValue, float64(metric.ContentLength), l...)
+		ch <- prometheus.MustNewConstMetric(descs.redir, prometheus.GaugeValue, float64(len(metric.Redirects)), append(l, metric.FinalURL)...)
+		for hop, redirect := range metric.Redirects {
+			ch <- prometheus.MustNewConstMetric(descs.redirT, prometheus.GaugeValue, redirect.Elapsed.Seconds(), append(l, strconv.Itoa(hop+1), redirect.URL, strconv.Itoa(redirect.Status))...)
+		}
 		ch <- prometheus.MustNewConstMetric(descs.time, prometheus.GaugeValue, metric.DNSLookup.Seconds(), append(l, "DNSLookup")...)
 		ch <- prometheus.MustNewConstMetric(descs.time, prometheus.GaugeValue, metric.TCPConnection.Seconds(), append(l, "TCPConnection")...)
+		ch <- prometheus.MustNewConstMetric(descs.time, prometheus.GaugeValue, metric.ProxyConnect.Seconds(), append(l, "ProxyConnect")...)
 		ch <- prometheus.MustNewConstMetric(descs.time, prometheus.GaugeValue, metric.TLSHandshake.Seconds(), append(l, "TLSHandshake")...)
 		if !metric.TLSEarliestCertExpiry.IsZero() {
 			ch <- prometheus.MustNewConstMetric(descs.time, prometheus.GaugeValue, float64(metric.TLSEarliestCertExpiry.Unix()), append(l, "TLSEarliestCertExpiry")...)
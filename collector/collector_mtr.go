@@ -18,6 +18,9 @@ var (
 	mtrSntFailDesc = prometheus.NewDesc("mtr_rtt_snt_fail_count", "Round Trip Send Package Fail Total", append(mtrLabelNames, "type"), nil)
 	mtrSntTimeDesc = prometheus.NewDesc("mtr_rtt_snt_seconds", "Round Trip Send Package Time Total", append(mtrLabelNames, "type"), nil)
 	mtrHopsDesc    = prometheus.NewDesc("mtr_hops", "Number of route hops", []string{"name", "target"}, nil)
+	mtrCycleDesc   = prometheus.NewDesc("mtr_cycle_seconds", "Duration of the last MTR cycle in seconds", []string{"name", "target"}, nil)
+	mtrFwdLossDesc = prometheus.NewDesc("mtr_hop_forward_loss", "Packet loss that persists from the hop to the destination in percent", mtrLabelNames, nil)
+	mtrOriginDesc  = prometheus.NewDesc("mtr_loss_origin_ttl", "TTL of the first hop where the forwarding loss begins (0 without loss)", []string{"name", "target"}, nil)
 	mtrTargetsDesc = prometheus.NewDesc("mtr_targets", "Number of active targets", nil, nil)
 	mtrStateDesc   = prometheus.NewDesc("mtr_up", "Exporter state", nil, nil)
 	mtrMutex       = &sync.Mutex{}
@@ -30,6 +33,9 @@ var (
 type mtrDescriptorSet struct {
 	rtt     *prometheus.Desc
 	hops    *prometheus.Desc
+	cycle   *prometheus.Desc
+	fwdLoss *prometheus.Desc
+	origin  *prometheus.Desc
 	snt     *prometheus.Desc
 	sntFail *prometheus.Desc
 	sntTime *prometheus.Desc
@@ -56,6 +62,9 @@ func getMTRDescriptors(labels prometheus.Labels) *mtrDescriptorSet {
 	descSet := &mtrDescriptorSet{
 		rtt:     prometheus.NewDesc("mtr_rtt_seconds", "Round Trip Time in seconds", append(mtrLabelNames, "type"), labels),
 		hops:    prometheus.NewDesc("mtr_hops", "Number of route hops", []string{"name", "target"}, labels),
+		cycle:   prometheus.NewDesc("mtr_cycle_seconds", "Duration of the last MTR cycle in seconds", []string{"name", "target"}, labels),
+		fwdLoss: prometheus.NewDesc("mtr_hop_forward_loss", "Packet loss that persists from the hop to the destination in percent", mtrLabelNames, labels),
+		origin:  prometheus.NewDesc("mtr_loss_origin_ttl", "TTL of the first hop where the forwarding loss begins (0 without loss)", []string{"name", "target"}, labels),
 		snt:     prometheus.NewDesc("mtr_rtt_snt_count", "Round Trip Send Package Total", mtrLabelNames, labels),
 		sntFail: prometheus.NewDesc("mtr_rtt_snt_fail_count", "Round Trip Send Package Fail Total", mtrLabelNames, labels),
 		sntTime: prometheus.NewDesc("mtr_rtt_snt_seconds", "Round Trip Send Package Time Total", mtrLabelNames, labels),
@@ -75,6 +84,9 @@ type MTR struct {
 func (p *MTR) Describe(ch chan<- *prometheus.Desc) {
 	ch <- mtrDesc
 	ch <- mtrHopsDesc
+	ch <- mtrCycleDesc
+	ch <- mtrFwdLossDesc
+	ch <- mtrOriginDesc
 	ch <- mtrTargetsDesc
 	ch <- mtrStateDesc
 }
@@ -108,6 +120,8 @@ func (p *MTR) Collect(ch chan<- prometheus.Metric) {
 		descs := getMTRDescriptors(l2)
 
 		ch <- prometheus.MustNewConstMetric(descs.hops, prometheus.GaugeValue, float64(len(metric.Hops)), l...)
+		ch <- prometheus.MustNewConstMetric(descs.cycle, prometheus.GaugeValue, metric.CycleTime.Seconds(), l...)
+		ch <- prometheus.MustNewConstMetric(descs.origin, prometheus.GaugeValue, float64(metric.LossOriginTTL), l...)
 		for _, hop := range metric.Hops {
 			ll := append(l, strconv.Itoa(hop.TTL))
 			ll = append(ll, hop.AddressTo)
@@ -121,6 +135,7 @@ func (p *MTR) Collect(ch chan<- prometheus.Metric) {
 			ch <- prometheus.MustNewConstMetric(descs.rtt, prometheus.GaugeValue, hop.CorrectedSDTime.Seconds(), append(ll, "csd")...)
 			ch <- prometheus.MustNewConstMetric(descs.rtt, prometheus.GaugeValue, hop.RangeTime.Seconds(), append(ll, "range")...)
 			ch <- prometheus.MustNewConstMetric(descs.rtt, prometheus.GaugeValue, float64(hop.Loss), append(ll, "loss")...)
+			ch <- prometheus.MustNewConstMetric(descs.fwdLoss, prometheus.GaugeValue, hop.ForwardLoss, ll...)
 		}
 
 		for ttl, summary := range metric.HopSummaryMap {
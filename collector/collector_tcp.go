@@ -2,6 +2,7 @@ package collector
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -14,6 +15,12 @@ var (
 	tcpLabelNames  = []string{"name", "target", "target_ip", "source_ip", "port"}
 	tcpTimeDesc    = prometheus.NewDesc("tcp_connection_seconds", "Connection time in seconds", tcpLabelNames, nil)
 	tcpStatusDesc  = prometheus.NewDesc("tcp_connection_status", "Connection Status", tcpLabelNames, nil)
+	tcpRttDesc     = prometheus.NewDesc("tcp_connection_rtt_seconds", "Connection time statistics in seconds", append(tcpLabelNames, "type"), nil)
+	tcpSntDesc     = prometheus.NewDesc("tcp_connection_snt_count", "Connection attempt count", tcpLabelNames, nil)
+	tcpSntFailDesc = prometheus.NewDesc("tcp_connection_snt_fail_count", "Connection attempt fail count", tcpLabelNames, nil)
+	tcpLossDesc    = prometheus.NewDesc("tcp_connection_loss_percent", "Connection loss in percent", tcpLabelNames, nil)
+	tcpQueryDesc   = prometheus.NewDesc("tcp_query_status", "Query Response Status", append(tcpLabelNames, "failed_step", "reason"), nil)
+	tcpQueryTDesc  = prometheus.NewDesc("tcp_query_step_seconds", "Query Response step time in seconds", append(tcpLabelNames, "step"), nil)
 	tcpTargetsDesc = prometheus.NewDesc("tcp_targets", "Number of active targets", nil, nil)
 	tcpStateDesc   = prometheus.NewDesc("tcp_up", "Exporter state", nil, nil)
 	tcpMutex       = &sync.Mutex{}
@@ -24,8 +31,14 @@ var (
 
 // tcpDescriptorSet holds all descriptors for a specific label set
 type tcpDescriptorSet struct {
-	time   *prometheus.Desc
-	status *prometheus.Desc
+	time    *prometheus.Desc
+	status  *prometheus.Desc
+	rtt     *prometheus.Desc
+	snt     *prometheus.Desc
+	sntFail *prometheus.Desc
+	loss    *prometheus.Desc
+	query   *prometheus.Desc
+	queryT  *prometheus.Desc
 }
 
 // getTCPDescriptors returns cached or creates new descriptors for a label set
@@ -47,8 +60,14 @@ func getTCPDescriptors(labels prometheus.Labels) *tcpDescriptorSet {
 	}
 
 	descSet := &tcpDescriptorSet{
-		time:   prometheus.NewDesc("tcp_connection_seconds", "Connection time in seconds", tcpLabelNames, labels),
-		status: prometheus.NewDesc("tcp_connection_status", "Connection Status", tcpLabelNames, labels),
+		time:    prometheus.NewDesc("tcp_connection_seconds", "Connection time in seconds", tcpLabelNames, labels),
+		status:  prometheus.NewDesc("tcp_connection_status", "Connection Status", tcpLabelNames, labels),
+		rtt:     prometheus.NewDesc("tcp_connection_rtt_seconds", "Connection time statistics in seconds", append(tcpLabelNames, "type"), labels),
+		snt:     prometheus.NewDesc("tcp_connection_snt_count", "Connection attempt count", tcpLabelNames, labels),
+		sntFail: prometheus.NewDesc("tcp_connection_snt_fail_count", "Connection attempt fail count", tcpLabelNames, labels),
+		loss:    prometheus.NewDesc("tcp_connection_loss_percent", "Connection loss in percent", tcpLabelNames, labels),
+		query:   prometheus.NewDesc("tcp_query_status", "Query Response Status", append(tcpLabelNames, "failed_step", "reason"), labels),
+		queryT:  prometheus.NewDesc("tcp_query_step_seconds", "Query Response step time in seconds", append(tcpLabelNames, "step"), labels),
 	}
 	tcpDescCache[cacheKey] = descSet
 	return descSet
@@ -65,6 +84,12 @@ type TCP struct {
 func (p *TCP) Describe(ch chan<- *prometheus.Desc) {
 	ch <- tcpTimeDesc
 	ch <- tcpStatusDesc
+	ch <- tcpRttDesc
+	ch <- tcpSntDesc
+	ch <- tcpSntFailDesc
+	ch <- tcpLossDesc
+	ch <- tcpQueryDesc
+	ch <- tcpQueryTDesc
 	ch <- tcpTargetsDesc
 	ch <- tcpStateDesc
 }
@@ -108,6 +133,33 @@ func (p *TCP) Collect(ch chan<- prometheus.Metric) {
 		} else {
 			ch <- prometheus.MustNewConstMetric(descs.status, prometheus.GaugeValue, 0, l...)
 		}
+
+		ch <- prometheus.MustNewConstMetric(descs.rtt, prometheus.GaugeValue, metric.BestTime.Seconds(), append(l, "best")...)
+		ch <- prometheus.MustNewConstMetric(descs.rtt, prometheus.GaugeValue, metric.AvgTime.Seconds(), append(l, "mean")...)
+		ch <- prometheus.MustNewConstMetric(descs.rtt, prometheus.GaugeValue, metric.WorstTime.Seconds(), append(l, "worst")...)
+		ch <- prometheus.MustNewConstMetric(descs.rtt, prometheus.GaugeValue, metric.SumTime.Seconds(), append(l, "sum")...)
+		ch <- prometheus.MustNewConstMetric(descs.rtt, prometheus.GaugeValue, metric.SquaredDeviationTime.Seconds(), append(l, "sd")...)
+		ch <- prometheus.MustNewConstMetric(descs.rtt, prometheus.GaugeValue, metric.UncorrectedSDTime.Seconds(), append(l, "usd")...)
+		ch <- prometheus.MustNewConstMetric(descs.rtt, prometheus.GaugeValue, metric.CorrectedSDTime.Seconds(), append(l, "csd")...)
+		ch <- prometheus.MustNewConstMetric(descs.rtt, prometheus.GaugeValue, metric.RangeTime.Seconds(), append(l, "range")...)
+		ch <- prometheus.MustNewConstMetric(descs.snt, prometheus.GaugeValue, float64(metric.SntSummary), l...)
+		ch <- prometheus.MustNewConstMetric(descs.sntFail, prometheus.GaugeValue, float64(metric.SntFailSummary), l...)
+		ch <- prometheus.MustNewConstMetric(descs.loss, prometheus.GaugeValue, metric.DropRate, l...)
+
+		if len(metric.QuerySteps) > 0 || metric.QueryFailure != "" {
+			for _, step := range metric.QuerySteps {
+				ch <- prometheus.MustNewConstMetric(descs.queryT, prometheus.GaugeValue, step.Elapsed.Seconds(), append(l, strconv.Itoa(step.Step))...)
+			}
+			if metric.QuerySuccess {
+				ch <- prometheus.MustNewConstMetric(descs.query, prometheus.GaugeValue, 1, append(l, "", "")...)
+			} else {
+				failedStep := strconv.Itoa(metric.QueryFailedStep)
+				if metric.QueryFailedStep == 0 {
+					failedStep = "connect"
+				}
+				ch <- prometheus.MustNewConstMetric(descs.query, prometheus.GaugeValue, 0, append(l, failedStep, metric.QueryFailure)...)
+			}
+		}
 	}
 	ch <- prometheus.MustNewConstMetric(tcpTargetsDesc, prometheus.GaugeValue, float64(len(targets)))
 }
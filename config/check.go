@@ -0,0 +1,253 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/creasty/defaults"
+	"github.com/syepes/network_exporter/pkg/common"
+	yaml "gopkg.in/yaml.v3"
+)
+
+var (
+	// labelName Prometheus label name
+	labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	// reservedLabels Labels set by the exporter metrics, that can't be used as target labels
+	reservedLabels = []string{"name", "target", "target_ip", "source_ip", "port", "ttl", "path", "type", "protocol", "final_url", "hop", "url", "status", "step", "failed_step", "reason", "owner", "src_probe", "dst_probe"}
+)
+
+// Check validates a configuration strictly and returns all the problems found with their line numbers
+// Unlike ReloadConfig, unknown fields and check types, invalid hosts, source IPs and label names are reported instead of being ignored or failing at runtime
+func Check(file string, data []byte) []error {
+	errs := []error{}
+
+	expanded, err := expandEnv(data)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if expanded == nil {
+		expanded = data
+	}
+
+	c := &Config{}
+	errs = append(errs, decodeStrict(expanded, c)...)
+
+	// Location of each target, its line in the config file and the included file
+	locations := []string{}
+	for _, line := range targetLines(data) {
+		locations = append(locations, fmt.Sprintf("line %d", line))
+	}
+
+	includes, err := c.readIncludes(file)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	templateFiles := map[string]string{}
+	for name := range c.Templates {
+		templateFiles[name] = file
+	}
+	for _, i := range includes {
+		f := &fragment{}
+		for _, err := range decodeStrict(i.data, f) {
+			errs = append(errs, fmt.Errorf("include %s: %s", i.file, err))
+		}
+		if err := c.mergeInclude(i.file, f, templateFiles); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, line := range targetLines(i.raw) {
+			locations = append(locations, fmt.Sprintf("include %s: line %d", i.file, line))
+		}
+	}
+	for len(locations) < len(c.Targets) {
+		locations = append(locations, "")
+	}
+
+	// The templates are applied before the defaults, as in ReloadConfig
+	invalid := map[int]bool{}
+	for i := range c.Targets {
+		t := &c.Targets[i]
+		if t.Template == "" {
+			continue
+		}
+		tmpl, found := c.Templates[t.Template]
+		if !found {
+			errs = append(errs, fmt.Errorf("%s: target %s: unknown template %s", locations[i], t.Name, t.Template))
+			invalid[i] = true
+			continue
+		}
+		t.applyTemplate(tmpl)
+	}
+
+	if err := defaults.Set(c); err != nil {
+		return append(errs, fmt.Errorf("setting defaults: %s", err))
+	}
+
+	if err := c.validateSettings(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.validateProbes(); err != nil {
+		errs = append(errs, err)
+	}
+
+	names := map[string]string{}
+	for i, t := range c.Targets {
+		if invalid[i] {
+			continue
+		}
+
+		if first, found := names[t.Name]; found {
+			errs = append(errs, fmt.Errorf("%s: target %s: duplicated name, first defined at %s", locations[i], t.Name, first))
+		} else {
+			names[t.Name] = locations[i]
+		}
+
+		if err := checkTarget(t, c.Conf.MaxHostExpansion); err != nil {
+			errs = append(errs, fmt.Errorf("%s: target %s: %s", locations[i], t.Name, err))
+		}
+	}
+	return errs
+}
+
+// decodeStrict parses a configuration, every unknown or invalid field is reported and the rest of the configuration is decoded
+func decodeStrict(data []byte, v interface{}) []error {
+	errs := []error{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(v); err != nil && err != io.EOF {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return append(errs, err)
+		}
+		for _, e := range typeErr.Errors {
+			errs = append(errs, errors.New(e))
+		}
+	}
+	return errs
+}
+
+// targetLines returns the line number of each target
+func targetLines(data []byte) []int {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil || len(root.Content) == 0 {
+		return nil
+	}
+
+	doc := root.Content[0]
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value != "targets" {
+			continue
+		}
+		lines := []int{}
+		for _, t := range doc.Content[i+1].Content {
+			lines = append(lines, t.Line)
+		}
+		return lines
+	}
+	return nil
+}
+
+// checkTarget checks a target, its check type, host format, source ip and labels
+func checkTarget(t Target, maxHostExpansion int) error {
+	if t.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if !checkTypes.MatchString(t.Type) {
+		return fmt.Errorf("unknown check type: %s, allowed: ICMP, MTR, ICMP+MTR, TCP or HTTPGet", t.Type)
+	}
+	if err := validateTarget(t); err != nil {
+		return err
+	}
+	if common.HostRangeCheck(t.Host) {
+		if t.Type != "ICMP" && t.Type != "MTR" && t.Type != "ICMP+MTR" {
+			return fmt.Errorf("host: ranges are only supported by the ICMP and MTR check types")
+		}
+		if _, err := common.HostRangeAddrs(t.Host, maxHostExpansion); err != nil {
+			return fmt.Errorf("host: %s", err)
+		}
+	} else if err := checkHost(t.Type, t.Host); err != nil {
+		return err
+	}
+	if t.SourceIp != "" && net.ParseIP(t.SourceIp) == nil {
+		return fmt.Errorf("source_ip: %s is not a valid IP", t.SourceIp)
+	}
+	for name := range t.Labels.Kv {
+		if !labelName.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("label: %s is not a valid label name", name)
+		}
+		if common.ContainsString(reservedLabels, name) {
+			return fmt.Errorf("label: %s is reserved by the exporter metrics", name)
+		}
+	}
+	return nil
+}
+
+// checkHost checks the host format of a check type
+func checkHost(checkType string, host string) error {
+	if host == "" {
+		return fmt.Errorf("host is required")
+	}
+
+	// SRV records are resolved at runtime (_service._proto.name)
+	if common.SrvRecordCheck(host) {
+		return nil
+	}
+
+	switch checkType {
+	case "HTTPGet":
+		u, err := url.Parse(host)
+		if err != nil {
+			return fmt.Errorf("host: %s", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("host: %s must be an http or https URL", host)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("host: %s is missing the URL host", host)
+		}
+	case "TCP":
+		h, ports, err := net.SplitHostPort(host)
+		if err != nil || h == "" {
+			return fmt.Errorf("host: %s must be host:port", host)
+		}
+		if _, err := common.ExpandPorts(ports); err != nil {
+			return fmt.Errorf("host: %s", err)
+		}
+	case "MTR":
+		// An optional port is used by the TCP and UDP protocols (host:port)
+		if net.ParseIP(host) != nil {
+			return nil
+		}
+		if h, port, found := strings.Cut(host, ":"); found {
+			if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 || h == "" {
+				return fmt.Errorf("host: %s must be host or host:port", host)
+			}
+			host = h
+		}
+		return checkHostname(host)
+	default:
+		if net.ParseIP(host) != nil {
+			return nil
+		}
+		return checkHostname(host)
+	}
+	return nil
+}
+
+// checkHostname checks that a host is an IP or a hostname without scheme, path or port
+func checkHostname(host string) error {
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	if strings.ContainsAny(host, ":/ ") {
+		return fmt.Errorf("host: %s must be a hostname or IP", host)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/syepes/network_exporter/pkg/cluster"
+	"github.com/syepes/network_exporter/pkg/common"
+)
+
+// settings returns the peer discovery and liveness check settings
+func (c Cluster) settings() cluster.Settings {
+	s := cluster.Settings{
+		Peers:    c.Peers,
+		PeersDNS: c.PeersDNS,
+		Scheme:   c.Scheme,
+		Interval: c.Interval.Duration(),
+		Timeout:  c.Timeout.Duration(),
+	}
+	if c.BasicAuth != nil {
+		s.Username = c.BasicAuth.Username
+		s.Password = c.BasicAuth.Password
+		s.PasswordFile = c.BasicAuth.PasswordFile
+	}
+	if c.TLSConfig != nil {
+		s.TLS = cluster.TLSSettings{
+			CAFile:             c.TLSConfig.CAFile,
+			CertFile:           c.TLSConfig.CertFile,
+			KeyFile:            c.TLSConfig.KeyFile,
+			ServerName:         c.TLSConfig.ServerName,
+			InsecureSkipVerify: c.TLSConfig.InsecureSkipVerify,
+		}
+	}
+	return s
+}
+
+// validate checks the cluster settings
+func (c Cluster) validate() error {
+	if !c.settings().Enabled() {
+		return nil
+	}
+	if c.Scheme != "http" && c.Scheme != "https" {
+		return fmt.Errorf("cluster.scheme must be 'http' or 'https'")
+	}
+	if c.Interval <= 0 || c.Timeout <= 0 {
+		return fmt.Errorf("cluster.interval and cluster.timeout must be >0")
+	}
+	if c.Replicas < 1 {
+		return fmt.Errorf("cluster.replicas must be >0")
+	}
+	if c.BasicAuth != nil && c.BasicAuth.Username == "" {
+		return fmt.Errorf("cluster.basic_auth.username is required")
+	}
+	if _, err := cluster.NewClient(c.settings()); err != nil {
+		return fmt.Errorf("cluster.tls_config: %s", err)
+	}
+	for _, p := range c.Peers {
+		if _, _, err := net.SplitHostPort(p); err != nil {
+			return fmt.Errorf("cluster.peers must be host:port: %s", p)
+		}
+	}
+	for _, name := range c.PeersDNS {
+		if common.SrvRecordCheck(name) {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(name); err != nil {
+			return fmt.Errorf("cluster.peers_dns must be a SRV record or name:port: %s", name)
+		}
+	}
+	return nil
+}
+
+// shard returns the targets owned by this instance, each target is owned by `replicas` live members chosen by rendezvous hashing of its name
+// The owner label is set to the ID of this instance
+func (c *Config) shard(cl *cluster.Cluster) Targets {
+	members := cl.Members()
+	targets := Targets{}
+	for _, t := range c.Targets {
+		if !common.ContainsString(common.Rendezvous(t.Name, members, c.Cluster.Replicas), cl.Self()) {
+			continue
+		}
+		labels := map[string]string{}
+		for k, v := range t.Labels.Kv {
+			labels[k] = v
+		}
+		labels["owner"] = cl.Self()
+		t.Labels = extraKV{Kv: labels}
+		targets = append(targets, t)
+	}
+	return targets
+}
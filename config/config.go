@@ -1,6 +1,8 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"log/slog"
@@ -8,12 +10,15 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/creasty/defaults"
+	"github.com/syepes/network_exporter/pkg/cluster"
 	"github.com/syepes/network_exporter/pkg/common"
 
 	yaml "gopkg.in/yaml.v3"
@@ -21,14 +26,60 @@ import (
 
 // Config represents configuration for the exporter
 
-type Targets []struct {
+type Targets []Target
+
+// Target represents a single target definition
+type Target struct {
 	Name     string   `yaml:"name" json:"name"`
+	Template string   `yaml:"template,omitempty" json:"template,omitempty"`
 	Host     string   `yaml:"host" json:"host"`
 	Type     string   `yaml:"type" json:"type"`
 	Proxy    string   `yaml:"proxy" json:"proxy"`
 	Probe    []string `yaml:"probe" json:"probe"`
 	SourceIp string   `yaml:"source_ip" json:"source_ip"`
 	Labels   extraKV  `yaml:"labels,omitempty" json:"labels,omitempty"`
+	// Probe assignment by probe labels and consistent hashing
+	ProbeSelector string `yaml:"probe_selector,omitempty" json:"probe_selector,omitempty"`
+	ProbeCount    *int   `yaml:"probe_count,omitempty" json:"probe_count,omitempty" default:"0"`
+	// HTTPGet specific settings
+	FollowRedirects *bool      `yaml:"follow_redirects" json:"follow_redirects" default:"true"`
+	MaxRedirects    *int       `yaml:"max_redirects" json:"max_redirects" default:"10"`
+	HTTPVersion     string     `yaml:"http_version" json:"http_version"`
+	BasicAuth       *BasicAuth `yaml:"basic_auth,omitempty" json:"basic_auth,omitempty"`
+	BearerToken     string     `yaml:"bearer_token,omitempty" json:"bearer_token,omitempty"`
+	BearerTokenFile string     `yaml:"bearer_token_file,omitempty" json:"bearer_token_file,omitempty"`
+	OAuth2          *OAuth2    `yaml:"oauth2,omitempty" json:"oauth2,omitempty"`
+	ProxyBasicAuth  *BasicAuth `yaml:"proxy_basic_auth,omitempty" json:"proxy_basic_auth,omitempty"`
+	NoProxy         []string   `yaml:"no_proxy,omitempty" json:"no_proxy,omitempty"`
+	ProxyFromEnv    *bool      `yaml:"proxy_from_environment,omitempty" json:"proxy_from_environment,omitempty" default:"false"`
+	ResolveAll      *bool      `yaml:"resolve_all,omitempty" json:"resolve_all,omitempty" default:"false"`
+	// TCP specific settings
+	Expect        string          `yaml:"expect,omitempty" json:"expect,omitempty"`
+	QueryResponse []QueryResponse `yaml:"query_response,omitempty" json:"query_response,omitempty"`
+}
+
+// BasicAuth HTTP basic authentication
+type BasicAuth struct {
+	Username     string `yaml:"username" json:"username"`
+	Password     string `yaml:"password,omitempty" json:"password,omitempty"`
+	PasswordFile string `yaml:"password_file,omitempty" json:"password_file,omitempty"`
+}
+
+// OAuth2 client credentials flow
+type OAuth2 struct {
+	ClientID         string            `yaml:"client_id" json:"client_id"`
+	ClientSecret     string            `yaml:"client_secret,omitempty" json:"client_secret,omitempty"`
+	ClientSecretFile string            `yaml:"client_secret_file,omitempty" json:"client_secret_file,omitempty"`
+	TokenURL         string            `yaml:"token_url" json:"token_url"`
+	Scopes           []string          `yaml:"scopes,omitempty" json:"scopes,omitempty"`
+	EndpointParams   map[string]string `yaml:"endpoint_params,omitempty" json:"endpoint_params,omitempty"`
+}
+
+// QueryResponse TCP send / expect dialogue step
+type QueryResponse struct {
+	Expect   string `yaml:"expect,omitempty" json:"expect,omitempty"`
+	Send     string `yaml:"send,omitempty" json:"send,omitempty"`
+	StartTLS bool   `yaml:"starttls,omitempty" json:"starttls,omitempty"`
 }
 
 type HTTPGet struct {
@@ -39,6 +90,7 @@ type HTTPGet struct {
 type TCP struct {
 	Interval duration `yaml:"interval" json:"interval" default:"5s"`
 	Timeout  duration `yaml:"timeout" json:"timeout" default:"4s"`
+	Count    int      `yaml:"count" json:"count" default:"1"`
 }
 
 type MTR struct {
@@ -49,6 +101,9 @@ type MTR struct {
 	PayloadSize int      `yaml:"payload_size" json:"payload_size" default:"56"`
 	Protocol    string   `yaml:"protocol" json:"protocol" default:"icmp"`
 	TcpPort     string   `yaml:"tcp_port" json:"tcp_port" default:"80"`
+	UdpPort     string   `yaml:"udp_port" json:"udp_port" default:"33434"`
+	UdpParis    bool     `yaml:"udp_paris" json:"udp_paris"`
+	Parallel    int      `yaml:"parallel" json:"parallel" default:"1"`
 }
 
 type ICMP struct {
@@ -62,19 +117,52 @@ type Conf struct {
 	Refresh           duration `yaml:"refresh" json:"refresh" default:"0s"`
 	Nameserver        string   `yaml:"nameserver" json:"nameserver"`
 	NameserverTimeout duration `yaml:"nameserver_timeout" json:"nameserver_timeout" default:"250ms"`
+	TargetFiles       []string `yaml:"target_files" json:"target_files"`
+	HTTPSD            []HTTPSD `yaml:"http_sd" json:"http_sd"`
+	MaxHostExpansion  int      `yaml:"max_host_expansion" json:"max_host_expansion" default:"256"`
+}
+
+// Cluster Exporter instances that share the targets
+type Cluster struct {
+	Peers    []string `yaml:"peers" json:"peers"`
+	PeersDNS []string `yaml:"peers_dns" json:"peers_dns"`
+	Scheme   string   `yaml:"scheme" json:"scheme" default:"http"`
+	Interval duration `yaml:"interval" json:"interval" default:"5s"`
+	Timeout  duration `yaml:"timeout" json:"timeout" default:"2s"`
+	Replicas int      `yaml:"replicas" json:"replicas" default:"1"`
+	// Credentials and TLS settings of the peers health check, when the web config requires them
+	BasicAuth *BasicAuth `yaml:"basic_auth,omitempty" json:"basic_auth,omitempty"`
+	TLSConfig *TLSConfig `yaml:"tls_config,omitempty" json:"tls_config,omitempty"`
+}
+
+// TLSConfig TLS client settings
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file,omitempty" json:"ca_file,omitempty"`
+	CertFile           string `yaml:"cert_file,omitempty" json:"cert_file,omitempty"`
+	KeyFile            string `yaml:"key_file,omitempty" json:"key_file,omitempty"`
+	ServerName         string `yaml:"server_name,omitempty" json:"server_name,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty" json:"insecure_skip_verify,omitempty"`
 }
 
 type Config struct {
-	Conf    `yaml:"conf" json:"conf"`
-	ICMP    `yaml:"icmp" json:"icmp"`
-	MTR     `yaml:"mtr" json:"mtr"`
-	TCP     `yaml:"tcp" json:"tcp"`
-	HTTPGet `yaml:"http_get" json:"http_get"`
-	Targets `yaml:"targets" json:"targets"`
+	Conf      `yaml:"conf" json:"conf"`
+	Cluster   `yaml:"cluster" json:"cluster"`
+	ICMP      `yaml:"icmp" json:"icmp"`
+	MTR       `yaml:"mtr" json:"mtr"`
+	TCP       `yaml:"tcp" json:"tcp"`
+	HTTPGet   `yaml:"http_get" json:"http_get"`
+	Probes    []Probe           `yaml:"probes,omitempty" json:"probes,omitempty"`
+	Mesh      []Mesh            `yaml:"mesh,omitempty" json:"mesh,omitempty"`
+	Include   []string          `yaml:"include,omitempty" json:"include,omitempty"`
+	Templates map[string]Target `yaml:"templates,omitempty" json:"templates,omitempty"`
+	Targets   `yaml:"targets" json:"targets"`
 }
 
 type duration time.Duration
 
+// checkTypes Supported check types
+var checkTypes = regexp.MustCompile(`^(ICMP|MTR|ICMP\+MTR|TCP|HTTPGet)$`)
+
 type extraKV struct {
 	Kv map[string]string `yaml:"kv,omitempty" json:"kv,omitempty"`
 }
@@ -93,7 +181,67 @@ type Resolver struct {
 // SafeConfig Safe configuration reload
 type SafeConfig struct {
 	Cfg *Config
+	// ProbeLabels Labels of the running probe (--probe.labels), they override the ones set in `probes`
+	ProbeLabels map[string]string
+	// Cluster Live exporter instances, the targets are sharded among them if `cluster` is configured
+	Cluster *cluster.Cluster
 	sync.RWMutex
+	sd     sdState
+	mesh   meshState
+	reload reloadState
+}
+
+// reloadState Result of the config reloads
+type reloadState struct {
+	mtx         sync.Mutex
+	success     bool
+	successTime time.Time
+	total       map[string]float64
+	hash        float64
+}
+
+// LastReload returns the result of the last config reload and the time of the last successful one
+func (sc *SafeConfig) LastReload() (bool, time.Time) {
+	sc.reload.mtx.Lock()
+	defer sc.reload.mtx.Unlock()
+	return sc.reload.success, sc.reload.successTime
+}
+
+// ReloadTotal returns the number of config reloads by result (success, failure)
+func (sc *SafeConfig) ReloadTotal() map[string]float64 {
+	sc.reload.mtx.Lock()
+	defer sc.reload.mtx.Unlock()
+
+	total := map[string]float64{"success": 0, "failure": 0}
+	for k, v := range sc.reload.total {
+		total[k] = v
+	}
+	return total
+}
+
+// Hash returns the hash of the loaded merged config (first 48 bits of the SHA256, exact as a float64)
+func (sc *SafeConfig) Hash() float64 {
+	sc.reload.mtx.Lock()
+	defer sc.reload.mtx.Unlock()
+	return sc.reload.hash
+}
+
+func (sc *SafeConfig) reloaded(success bool, data []byte) {
+	sc.reload.mtx.Lock()
+	defer sc.reload.mtx.Unlock()
+
+	if sc.reload.total == nil {
+		sc.reload.total = map[string]float64{}
+	}
+	sc.reload.success = success
+	if !success {
+		sc.reload.total["failure"]++
+		return
+	}
+	sc.reload.total["success"]++
+	sc.reload.successTime = time.Now()
+	sum := sha256.Sum256(data)
+	sc.reload.hash = float64(binary.BigEndian.Uint64(sum[:8]) >> 16)
 }
 
 func isHTTPURL(s string) bool {
@@ -114,21 +262,23 @@ func parse(data []byte, c *Config) error {
 	return nil
 }
 
-// ReloadConfig Safe configuration reload
-func (sc *SafeConfig) ReloadConfig(logger *slog.Logger, confFile string, confFileHeaders http.Header) (err error) {
-	hostname, err := os.Hostname()
-	if err != nil {
-		return fmt.Errorf("getting hostname: %s", err)
+// Default returns a configuration with the default settings and without targets
+func Default() (*Config, error) {
+	c := &Config{}
+	if err := defaults.Set(c); err != nil {
+		return nil, fmt.Errorf("setting defaults: %s", err)
 	}
+	return c, nil
+}
 
-	var data []byte
-
+// readConfig reads the configuration file, from a local file or an HTTP URL
+func readConfig(logger *slog.Logger, confFile string, confFileHeaders http.Header) ([]byte, error) {
 	if isHTTPURL(confFile) {
 		logger.Debug("Loading config from HTTP")
 
 		req, err := http.NewRequest("GET", confFile, nil)
 		if err != nil {
-			return fmt.Errorf("creating request: %s", err)
+			return nil, fmt.Errorf("creating request: %s", err)
 		}
 
 		for key, values := range confFileHeaders {
@@ -150,46 +300,130 @@ func (sc *SafeConfig) ReloadConfig(logger *slog.Logger, confFile string, confFil
 		}
 		resp, err := client.Do(req)
 		if err != nil {
-			return fmt.Errorf("fetching config file: %s", err)
+			return nil, fmt.Errorf("fetching config file: %s", err)
 		}
 		defer resp.Body.Close()
 
-		data, err = io.ReadAll(resp.Body)
+		data, err := io.ReadAll(resp.Body)
 		if err != nil {
-			return fmt.Errorf("reading config file: %s", err)
+			return nil, fmt.Errorf("reading config file: %s", err)
 		}
-	} else {
-		logger.Debug("Loading config from file")
+		return data, nil
+	}
 
-		f, err := os.Open(confFile)
-		if err != nil {
-			return fmt.Errorf("reading config file: %s", err)
-		}
-		defer f.Close()
+	logger.Debug("Loading config from file")
 
-		data, err = io.ReadAll(f)
-		if err != nil {
-			return fmt.Errorf("reading config file: %s", err)
-		}
+	f, err := os.Open(confFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %s", err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %s", err)
+	}
+	return data, nil
+}
+
+// Load reads the configuration file and sets the defaults, without the includes, target discovery and validation of ReloadConfig
+// Used by the one-shot commands that only need the protocol settings
+func Load(logger *slog.Logger, confFile string, confFileHeaders http.Header) (*Config, error) {
+	data, err := readConfig(logger, confFile, confFileHeaders)
+	if err != nil {
+		return nil, err
+	}
+	expanded, err := expandEnv(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file: %s", err)
+	}
+
+	c := &Config{}
+	if err := parse(expanded, c); err != nil {
+		return nil, fmt.Errorf("parsing config file: %s", err)
+	}
+	if err := defaults.Set(c); err != nil {
+		return nil, fmt.Errorf("setting defaults: %s", err)
+	}
+	return c, nil
+}
+
+// ReloadConfig Safe configuration reload
+func (sc *SafeConfig) ReloadConfig(logger *slog.Logger, confFile string, confFileHeaders http.Header) (err error) {
+	var data, merged []byte
+	defer func() {
+		sc.reloaded(err == nil, merged)
+	}()
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("getting hostname: %s", err)
+	}
+
+	data, err = readConfig(logger, confFile, confFileHeaders)
+	if err != nil {
+		return err
+	}
+
+	expanded, err := expandEnv(data)
+	if err != nil {
+		return fmt.Errorf("parsing config file: %s", err)
 	}
 
 	var c = &Config{}
 
-	err = parse(data, c)
+	err = parse(expanded, c)
 	if err != nil {
 		return fmt.Errorf("parsing config file: %s", err)
 	}
 
+	origins, err := c.loadIncludes(confFile)
+	if err != nil {
+		return fmt.Errorf("parsing config file: %s", err)
+	}
+	if err := c.applyTemplates(origins); err != nil {
+		return fmt.Errorf("parsing config file: %s", err)
+	}
+
+	// Relative target files are resolved from the config file directory
+	if len(c.Conf.TargetFiles) > 0 {
+		for i, pattern := range c.Conf.TargetFiles {
+			if !filepath.IsAbs(pattern) && !isHTTPURL(confFile) {
+				c.Conf.TargetFiles[i] = filepath.Join(filepath.Dir(confFile), pattern)
+			}
+		}
+		c.Targets = sc.loadTargetFiles(logger, c.Conf.TargetFiles, c.Targets)
+	}
+	if len(c.Conf.HTTPSD) > 0 {
+		c.Targets = sc.httpSDTargets(logger, c.Conf.HTTPSD, c.Targets)
+	}
+
 	if err := defaults.Set(c); err != nil {
 		return fmt.Errorf("setting defaults: %s", err)
 	}
 
+	// The hash covers the merged config (includes, templates, target files and http_sd) before the targets are filtered for this instance
+	merged, err = yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("marshaling config: %s", err)
+	}
+
+	if err := c.validateProbes(); err != nil {
+		return err
+	}
+	self := c.probeSelf(logger, hostname, sc.ProbeLabels)
+
 	// Validate and Filter config
 	targets := Targets{}
-	re := regexp.MustCompile("^ICMP|MTR|ICMP+MTR|TCP|HTTPGet$")
 	for _, t := range c.Targets {
+		// The probe settings are compiled once for all the sub targets
+		a, err := newAssignment(t)
+		if err != nil {
+			return fmt.Errorf("target %s: %s", t.Name, err)
+		}
+
 		if common.SrvRecordCheck(t.Host) {
-			found := re.MatchString(t.Type)
+			found := checkTypes.MatchString(t.Type)
 			if !found {
 				logger.Error("Unknown check type", "type", "Config", "func", "ReloadConfig", "target", t.Name, "check_type", t.Type, "allowed", "(ICMP|MTR|ICMP+MTR|TCP|HTTPGet)")
 				continue
@@ -213,47 +447,96 @@ func (sc *SafeConfig) ReloadConfig(logger *slog.Logger, confFile string, confFil
 				sub_target.Name = srvTarget
 				sub_target.Host = srvTarget
 
-				// Filter out the targets that are not assigned to the running host, if the `probe` is not specified don't filter
-				if sub_target.Probe == nil {
+				// Filter out the targets that are not assigned to the running host, if the `probe` settings are not specified don't filter
+				if a.assigned(sub_target.Name, self, c.Probes) {
+					targets = append(targets, sub_target)
+				}
+			}
+		} else if common.HostRangeCheck(t.Host) {
+			if t.Type != "ICMP" && t.Type != "MTR" && t.Type != "ICMP+MTR" {
+				logger.Error("Host ranges are only supported by the ICMP and MTR check types", "type", "Config", "func", "ReloadConfig", "target", t.Name, "check_type", t.Type)
+				continue
+			}
+
+			ipAddrs, err := common.HostRangeAddrs(t.Host, c.Conf.MaxHostExpansion)
+			if err != nil {
+				logger.Error("Error expanding host range", "type", "Config", "func", "ReloadConfig", "target", t.Name, "err", err)
+				continue
+			}
+
+			for _, ipAddr := range ipAddrs {
+				sub_target := t
+				sub_target.Name = t.Name + "-" + ipAddr
+				sub_target.Host = ipAddr
+				sub_target.Labels = extraKV{Kv: map[string]string{}}
+				for k, v := range t.Labels.Kv {
+					sub_target.Labels.Kv[k] = v
+				}
+				sub_target.Labels.Kv["network"] = t.Host
+				sub_target.Labels.Kv["address"] = ipAddr
+
+				// Filter out the targets that are not assigned to the running host, if the `probe` settings are not specified don't filter
+				if a.assigned(sub_target.Name, self, c.Probes) {
 					targets = append(targets, sub_target)
-				} else {
-					for _, p := range sub_target.Probe {
-						if p == hostname {
-							targets = append(targets, sub_target)
-							break
-						}
-					}
 				}
 			}
 		} else {
-			found := re.MatchString(t.Type)
+			found := checkTypes.MatchString(t.Type)
 			if !found {
 				logger.Error("Unknown check type", "type", "Config", "func", "ReloadConfig", "target", t.Name, "check_type", t.Type, "allowed", "(ICMP|MTR|ICMP+MTR|TCP|HTTPGet)")
 				continue
 			}
 
-			// Filter out the targets that are not assigned to the running host, if the `probe` is not specified don't filter
-			if t.Probe == nil {
+			// Filter out the targets that are not assigned to the running host, if the `probe` settings are not specified don't filter
+			if a.assigned(t.Name, self, c.Probes) {
 				targets = append(targets, t)
-			} else {
-				for _, p := range t.Probe {
-					if p == hostname {
-						targets = append(targets, t)
-						break
-					}
-				}
 			}
 		}
 	}
 
 	// Remap the filtered targets
 	c.Targets = targets
+	if sc.Cluster != nil && c.Cluster.settings().Enabled() {
+		c.Targets = c.shard(sc.Cluster)
+	}
+	// The mesh targets run on every probe of the group, they are not sharded
+	if len(c.Mesh) > 0 {
+		c.Targets = append(c.Targets, sc.meshTargets(logger, hostname, c.Mesh)...)
+	}
 
 	if _, err = HasDuplicateTargets(c.Targets); err != nil {
 		return fmt.Errorf("parsing config file: %s", err)
 	}
 
-	// Config precheck
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	sc.Lock()
+	sc.Cfg = c
+	sc.Unlock()
+
+	if sc.Cluster != nil {
+		sc.Cluster.Set(c.Cluster.settings())
+	}
+	return nil
+}
+
+// validate checks the protocol settings and the targets
+func (c *Config) validate() error {
+	if err := c.validateSettings(); err != nil {
+		return err
+	}
+	for _, t := range c.Targets {
+		if err := validateTarget(t); err != nil {
+			return fmt.Errorf("target %s: %s", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateSettings checks the protocol settings
+func (c *Config) validateSettings() error {
 	if c.ICMP.Interval <= 0 || c.MTR.Interval <= 0 || c.TCP.Interval <= 0 || c.HTTPGet.Interval <= 0 {
 		return fmt.Errorf("intervals (icmp,mtr,tcp,http_get) must be >0")
 	}
@@ -263,14 +546,170 @@ func (sc *SafeConfig) ReloadConfig(logger *slog.Logger, confFile string, confFil
 	if c.MTR.Count < 0 || c.MTR.Count > 65500 {
 		return fmt.Errorf("mtr.count must be between 0 and 65500")
 	}
-	if c.MTR.Protocol != "icmp" && c.MTR.Protocol != "tcp" {
-		return fmt.Errorf("mtr.protocol must be 'icmp' or 'tcp'")
+	if c.MTR.Parallel < 0 || c.MTR.Parallel > 65500 {
+		return fmt.Errorf("mtr.parallel must be between 0 and 65500")
+	}
+	if c.TCP.Count < 0 || c.TCP.Count > 65500 {
+		return fmt.Errorf("tcp.count must be between 0 and 65500")
+	}
+	// The connects of a run are sequential, a run must end before the next one starts
+	if run := time.Duration(max(c.TCP.Count, 1)) * c.TCP.Timeout.Duration(); run > c.TCP.Interval.Duration() {
+		return fmt.Errorf("tcp.count x tcp.timeout (%v) must be <= tcp.interval (%v)", run, c.TCP.Interval.Duration())
+	}
+	if err := CheckPayloadSize(c.ICMP.PayloadSize); err != nil {
+		return fmt.Errorf("icmp.payload_size %s", err)
+	}
+	if err := CheckPayloadSize(c.MTR.PayloadSize); err != nil {
+		return fmt.Errorf("mtr.payload_size %s", err)
+	}
+	if c.MTR.Protocol != "icmp" && c.MTR.Protocol != "tcp" && c.MTR.Protocol != "udp" {
+		return fmt.Errorf("mtr.protocol must be 'icmp', 'tcp' or 'udp'")
+	}
+	if port, err := strconv.Atoi(c.MTR.UdpPort); err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("mtr.udp_port must be between 1 and 65535")
+	}
+	if err := c.Cluster.validate(); err != nil {
+		return err
+	}
+	if err := c.validateMesh(); err != nil {
+		return err
+	}
+	if c.Conf.MaxHostExpansion < 1 {
+		return fmt.Errorf("conf.max_host_expansion must be >0")
+	}
+	for _, s := range c.Conf.HTTPSD {
+		if !isHTTPURL(s.URL) {
+			return fmt.Errorf("conf.http_sd url must be an http or https URL: %s", s.URL)
+		}
+		if s.RefreshInterval <= 0 {
+			return fmt.Errorf("conf.http_sd refresh_interval must be >0")
+		}
 	}
+	return nil
+}
 
-	sc.Lock()
-	sc.Cfg = c
-	sc.Unlock()
+// CheckPayloadSize checks an ICMP / UDP payload size, the first 4 bytes hold the probe sequence number and the packet must fit in the MTU
+func CheckPayloadSize(size int) error {
+	if size < 4 || size > 1472 {
+		return fmt.Errorf("must be between 4 and 1472")
+	}
+	return nil
+}
 
+// validateTarget checks the settings of a target
+func validateTarget(t Target) error {
+	if *t.MaxRedirects < 0 {
+		return fmt.Errorf("max_redirects must be >=0")
+	}
+	if t.HTTPVersion != "" && t.HTTPVersion != "1.1" && t.HTTPVersion != "2" && t.HTTPVersion != "3" {
+		return fmt.Errorf("http_version must be '1.1', '2' or '3'")
+	}
+	if err := validateAuth(t.BasicAuth, t.BearerToken, t.BearerTokenFile, t.OAuth2); err != nil {
+		return err
+	}
+	if t.HTTPVersion == "3" && !strings.HasPrefix(t.Host, "https://") {
+		return fmt.Errorf("http_version '3' requires an https URL")
+	}
+	if err := validateProxy(t.Proxy, t.ProxyBasicAuth, *t.ProxyFromEnv); err != nil {
+		return err
+	}
+	if t.HTTPVersion == "3" && (t.Proxy != "" || *t.ProxyFromEnv) {
+		return fmt.Errorf("http_version '3' can not be used with a proxy")
+	}
+	if *t.ResolveAll && (t.Proxy != "" || *t.ProxyFromEnv) {
+		return fmt.Errorf("resolve_all can not be used with a proxy")
+	}
+	if err := validateQueryResponse(t.QueryResponse); err != nil {
+		return err
+	}
+	if t.Expect != "" && t.Expect != "open" && t.Expect != "closed" && t.Expect != "filtered" {
+		return fmt.Errorf("expect must be 'open', 'closed' or 'filtered'")
+	}
+	if (t.Expect == "closed" || t.Expect == "filtered") && len(t.QueryResponse) > 0 {
+		return fmt.Errorf("query_response can not be used with expect '%s'", t.Expect)
+	}
+	if err := validateAssignment(t); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateAuth checks that at most one authentication method is configured and that it is complete
+func validateAuth(basicAuth *BasicAuth, bearerToken string, bearerTokenFile string, oauth2 *OAuth2) error {
+	methods := 0
+	if basicAuth != nil {
+		methods++
+		if basicAuth.Username == "" {
+			return fmt.Errorf("basic_auth.username is required")
+		}
+		if basicAuth.Password != "" && basicAuth.PasswordFile != "" {
+			return fmt.Errorf("basic_auth.password and basic_auth.password_file are mutually exclusive")
+		}
+	}
+	if bearerToken != "" || bearerTokenFile != "" {
+		methods++
+		if bearerToken != "" && bearerTokenFile != "" {
+			return fmt.Errorf("bearer_token and bearer_token_file are mutually exclusive")
+		}
+	}
+	if oauth2 != nil {
+		methods++
+		if oauth2.ClientID == "" || oauth2.TokenURL == "" {
+			return fmt.Errorf("oauth2.client_id and oauth2.token_url are required")
+		}
+		if oauth2.ClientSecret != "" && oauth2.ClientSecretFile != "" {
+			return fmt.Errorf("oauth2.client_secret and oauth2.client_secret_file are mutually exclusive")
+		}
+	}
+	if methods > 1 {
+		return fmt.Errorf("only one of basic_auth, bearer_token/bearer_token_file and oauth2 can be configured")
+	}
+	return nil
+}
+
+// validateQueryResponse checks that every query_response step does something and that the expect regexps compile
+func validateQueryResponse(steps []QueryResponse) error {
+	for i, qr := range steps {
+		if qr.Expect == "" && qr.Send == "" && !qr.StartTLS {
+			return fmt.Errorf("query_response step %d: expect, send or starttls is required", i+1)
+		}
+		if qr.Expect != "" {
+			if _, err := regexp.Compile(qr.Expect); err != nil {
+				return fmt.Errorf("query_response step %d: invalid expect: %s", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateProxy checks the proxy URL scheme and settings
+func validateProxy(proxy string, proxyBasicAuth *BasicAuth, proxyFromEnv bool) error {
+	if proxy != "" && proxyFromEnv {
+		return fmt.Errorf("proxy and proxy_from_environment are mutually exclusive")
+	}
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid proxy: %s", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" && u.Scheme != "socks5h" {
+			return fmt.Errorf("proxy scheme must be 'http', 'https', 'socks5' or 'socks5h'")
+		}
+		if u.Host == "" {
+			return fmt.Errorf("proxy host is missing")
+		}
+	}
+	if proxyBasicAuth != nil {
+		if proxy == "" && !proxyFromEnv {
+			return fmt.Errorf("proxy_basic_auth requires proxy or proxy_from_environment")
+		}
+		if proxyBasicAuth.Username == "" {
+			return fmt.Errorf("proxy_basic_auth.username is required")
+		}
+		if proxyBasicAuth.Password != "" && proxyBasicAuth.PasswordFile != "" {
+			return fmt.Errorf("proxy_basic_auth.password and proxy_basic_auth.password_file are mutually exclusive")
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/syepes/network_exporter/pkg/common"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// fileSDGroup Prometheus file_sd target group (JSON or YAML)
+// The target settings are taken from the meta labels (__type, __probe, __probe_selector, __probe_count and __source_ip), the other labels are added as extra labels
+type fileSDGroup struct {
+	Targets []string          `yaml:"targets"`
+	Labels  map[string]string `yaml:"labels"`
+}
+
+// WatchDirs returns the directories of the included files and the target files
+func (c *Config) WatchDirs() []string {
+	dirs := []string{}
+	for _, pattern := range append(append([]string{}, c.Include...), c.Conf.TargetFiles...) {
+		dir := filepath.Dir(pattern)
+		matches, err := filepath.Glob(dir)
+		if err != nil {
+			continue
+		}
+		for _, m := range matches {
+			if fi, err := os.Stat(m); err == nil && fi.IsDir() {
+				dirs = common.AppendIfMissing(dirs, m)
+			}
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// loadTargetFiles returns the targets of all the files matching the target_files globs
+// Malformed files and duplicated targets are logged and skipped without affecting the rest of the configuration
+func (sc *SafeConfig) loadTargetFiles(logger *slog.Logger, patterns []string, targets Targets) Targets {
+	for _, pattern := range patterns {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			logger.Error("Invalid target files pattern", "type", "Config", "func", "loadTargetFiles", "pattern", pattern, "err", err)
+			sc.sdFailure("file")
+			continue
+		}
+
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err == nil {
+				var fileTargets Targets
+				if fileTargets, err = parseTargetGroups(data); err == nil {
+					targets = mergeTargets(logger, targets, fileTargets, file)
+					logger.Debug("Target file loaded", "type", "Config", "func", "loadTargetFiles", "file", file, "targets", len(fileTargets))
+					continue
+				}
+			}
+			logger.Error("Skipping target file", "type", "Config", "func", "loadTargetFiles", "file", file, "err", err)
+			sc.sdFailure("file")
+		}
+	}
+	return targets
+}
+
+// mergeTargets appends the discovered targets, skipping the ones already defined
+func mergeTargets(logger *slog.Logger, targets Targets, add Targets, source string) Targets {
+	names := map[string]bool{}
+	for _, t := range targets {
+		names[t.Name] = true
+	}
+	for _, t := range add {
+		if names[t.Name] {
+			logger.Error("Skipping duplicated target", "type", "Config", "func", "mergeTargets", "source", source, "target", t.Name)
+			continue
+		}
+		names[t.Name] = true
+		targets = append(targets, t)
+	}
+	return targets
+}
+
+// parseTargetGroups parses a list of file_sd / http_sd target groups, the list is rejected if any of its groups is invalid
+func parseTargetGroups(data []byte) (Targets, error) {
+	// JSON is a subset of YAML, both formats are parsed by the same decoder
+	groups := []fileSDGroup{}
+	if err := yaml.Unmarshal(data, &groups); err != nil {
+		return nil, fmt.Errorf("parsing target groups: %s", err)
+	}
+
+	targets := Targets{}
+	for i, g := range groups {
+		checkType := g.Labels["__type"]
+		if checkType == "" {
+			return nil, fmt.Errorf("group %d: missing __type label", i)
+		}
+		if !checkTypes.MatchString(checkType) {
+			return nil, fmt.Errorf("group %d: unknown check type: %s", i, checkType)
+		}
+
+		var probe []string
+		if p := g.Labels["__probe"]; p != "" {
+			probe = strings.Split(p, ",")
+		}
+		var probeCount *int
+		if p := g.Labels["__probe_count"]; p != "" {
+			n, err := strconv.Atoi(p)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("group %d: invalid __probe_count label: %s", i, p)
+			}
+			probeCount = &n
+		}
+
+		labels := map[string]string{}
+		for k, v := range g.Labels {
+			if !strings.HasPrefix(k, "__") {
+				labels[k] = v
+			}
+		}
+
+		for _, host := range g.Targets {
+			if host == "" {
+				return nil, fmt.Errorf("group %d: empty target", i)
+			}
+			targets = append(targets, Target{
+				Name:          host,
+				Host:          host,
+				Type:          checkType,
+				Probe:         probe,
+				ProbeSelector: g.Labels["__probe_selector"],
+				ProbeCount:    probeCount,
+				SourceIp:      g.Labels["__source_ip"],
+				Labels:        extraKV{Kv: labels},
+			})
+		}
+	}
+	return targets, nil
+}
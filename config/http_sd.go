@@ -0,0 +1,199 @@
+package config
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HTTPSD Prometheus HTTP SD target source
+type HTTPSD struct {
+	URL             string            `yaml:"url" json:"url"`
+	RefreshInterval duration          `yaml:"refresh_interval" json:"refresh_interval" default:"60s"`
+	Headers         map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+}
+
+// sdState Service discovery state kept between the config reloads
+type sdState struct {
+	mtx      sync.Mutex
+	http     map[string]*httpSDSource
+	failures map[string]float64
+}
+
+// httpSDSource Last good target list of an HTTP SD source
+type httpSDSource struct {
+	targets     Targets
+	etag        string
+	sum         [sha256.Size]byte
+	lastRefresh time.Time
+}
+
+var sdClient = &http.Client{Timeout: 30 * time.Second}
+
+// httpSDMaxSize Maximum size of an HTTP SD response
+const httpSDMaxSize = 10 << 20
+
+// SDRefreshFailures returns the number of failed service discovery refreshes by mechanism (file, http)
+func (sc *SafeConfig) SDRefreshFailures() map[string]float64 {
+	sc.sd.mtx.Lock()
+	defer sc.sd.mtx.Unlock()
+
+	failures := map[string]float64{"file": 0, "http": 0}
+	for k, v := range sc.sd.failures {
+		failures[k] = v
+	}
+	return failures
+}
+
+func (sc *SafeConfig) sdFailure(mechanism string) {
+	sc.sd.mtx.Lock()
+	defer sc.sd.mtx.Unlock()
+
+	if sc.sd.failures == nil {
+		sc.sd.failures = map[string]float64{}
+	}
+	sc.sd.failures[mechanism]++
+}
+
+// RefreshHTTPSD fetches the HTTP SD sources whose refresh interval has elapsed and reports if any target list has changed
+func (sc *SafeConfig) RefreshHTTPSD(logger *slog.Logger) bool {
+	sc.RLock()
+	sources := sc.Cfg.Conf.HTTPSD
+	sc.RUnlock()
+
+	changed := false
+	for _, s := range sources {
+		sc.sd.mtx.Lock()
+		src, found := sc.sd.http[s.URL]
+		due := !found || time.Since(src.lastRefresh) >= s.RefreshInterval.Duration()
+		sc.sd.mtx.Unlock()
+		if !due {
+			continue
+		}
+
+		updated, err := sc.fetchHTTPSD(s)
+		if err != nil {
+			logger.Error("Refreshing HTTP SD, keeping the last good targets", "type", "Config", "func", "RefreshHTTPSD", "url", s.URL, "err", err)
+			sc.sdFailure("http")
+			continue
+		}
+		if updated {
+			logger.Debug("HTTP SD targets changed", "type", "Config", "func", "RefreshHTTPSD", "url", s.URL)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// httpSDTargets appends the last good targets of the HTTP SD sources, the sources that were never fetched are fetched first
+func (sc *SafeConfig) httpSDTargets(logger *slog.Logger, sources []HTTPSD, targets Targets) Targets {
+	for _, s := range sources {
+		sc.sd.mtx.Lock()
+		_, found := sc.sd.http[s.URL]
+		sc.sd.mtx.Unlock()
+
+		if !found {
+			if _, err := sc.fetchHTTPSD(s); err != nil {
+				logger.Error("Fetching HTTP SD", "type", "Config", "func", "httpSDTargets", "url", s.URL, "err", err)
+				sc.sdFailure("http")
+			}
+		}
+
+		sc.sd.mtx.Lock()
+		var sdTargets Targets
+		if src, found := sc.sd.http[s.URL]; found {
+			sdTargets = src.targets
+		}
+		sc.sd.mtx.Unlock()
+
+		targets = mergeTargets(logger, targets, sdTargets, s.URL)
+	}
+
+	// Drop the sources that are no longer configured
+	sc.sd.mtx.Lock()
+	for url := range sc.sd.http {
+		configured := false
+		for _, s := range sources {
+			if s.URL == url {
+				configured = true
+				break
+			}
+		}
+		if !configured {
+			delete(sc.sd.http, url)
+		}
+	}
+	sc.sd.mtx.Unlock()
+
+	return targets
+}
+
+// fetchHTTPSD fetches the target list of an HTTP SD source, unchanged payloads (ETag / If-None-Match) are skipped
+// On error the last good target list is kept until the next refresh interval
+func (sc *SafeConfig) fetchHTTPSD(s HTTPSD) (bool, error) {
+	sc.sd.mtx.Lock()
+	if sc.sd.http == nil {
+		sc.sd.http = map[string]*httpSDSource{}
+	}
+	src, found := sc.sd.http[s.URL]
+	if !found {
+		src = &httpSDSource{}
+		sc.sd.http[s.URL] = src
+	}
+	src.lastRefresh = time.Now()
+	etag := src.etag
+	sc.sd.mtx.Unlock()
+
+	req, err := http.NewRequest("GET", s.URL, nil)
+	if err != nil {
+		return false, fmt.Errorf("creating request: %s", err)
+	}
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Accept", "application/json")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := sdClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, httpSDMaxSize+1))
+	if err != nil {
+		return false, fmt.Errorf("reading response: %s", err)
+	}
+	if len(data) > httpSDMaxSize {
+		return false, fmt.Errorf("response larger than %d bytes", httpSDMaxSize)
+	}
+	targets, err := parseTargetGroups(data)
+	if err != nil {
+		return false, err
+	}
+
+	sum := sha256.Sum256(data)
+
+	sc.sd.mtx.Lock()
+	defer sc.sd.mtx.Unlock()
+	src.etag = resp.Header.Get("ETag")
+	if found && sum == src.sum {
+		return false, nil
+	}
+	src.sum = sum
+	src.targets = targets
+	return true, nil
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// sdServer HTTP SD test server, the response can be changed between the requests
+type sdServer struct {
+	mtx         sync.Mutex
+	status      int
+	body        string
+	etag        string
+	notModified int
+}
+
+func (s *sdServer) set(status int, body string, etag string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.status = status
+	s.body = body
+	s.etag = etag
+}
+
+func (s *sdServer) notModifiedCount() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.notModified
+}
+
+func (s *sdServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.etag != "" && r.Header.Get("If-None-Match") == s.etag {
+		s.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if s.etag != "" {
+		w.Header().Set("ETag", s.etag)
+	}
+	w.WriteHeader(s.status)
+	io.WriteString(w, s.body)
+}
+
+const sdGroups = `[{"targets": ["192.0.2.1", "192.0.2.2"], "labels": {"__type": "ICMP", "site": "fra"}}]`
+
+// newSDConfig returns a config with a single HTTP SD source refreshed on every call
+func newSDConfig(t *testing.T, url string) *SafeConfig {
+	t.Helper()
+	c, err := Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Conf.HTTPSD = []HTTPSD{{URL: url}}
+	return &SafeConfig{Cfg: c}
+}
+
+func targetNames(targets Targets) string {
+	names := []string{}
+	for _, t := range targets {
+		names = append(names, t.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestHTTPSDInitialFetch(t *testing.T) {
+	srv := &sdServer{}
+	srv.set(http.StatusOK, sdGroups, "")
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sc := newSDConfig(t, ts.URL)
+	targets := sc.httpSDTargets(logger, sc.Cfg.Conf.HTTPSD, Targets{{Name: "static"}})
+
+	if got := targetNames(targets); got != "static,192.0.2.1,192.0.2.2" {
+		t.Fatalf("targets: got %s", got)
+	}
+	if targets[1].Type != "ICMP" || targets[1].Labels.Kv["site"] != "fra" {
+		t.Errorf("target settings: got type %s labels %v", targets[1].Type, targets[1].Labels.Kv)
+	}
+	if f := sc.SDRefreshFailures()["http"]; f != 0 {
+		t.Errorf("failures: got %v, want 0", f)
+	}
+}
+
+func TestHTTPSDNotModified(t *testing.T) {
+	srv := &sdServer{}
+	srv.set(http.StatusOK, sdGroups, `"v1"`)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sc := newSDConfig(t, ts.URL)
+	sc.httpSDTargets(logger, sc.Cfg.Conf.HTTPSD, Targets{})
+
+	if sc.RefreshHTTPSD(logger) {
+		t.Error("refresh: unchanged target list reported as changed")
+	}
+	if n := srv.notModifiedCount(); n != 1 {
+		t.Errorf("If-None-Match: got %d not modified responses, want 1", n)
+	}
+
+	srv.set(http.StatusOK, `[{"targets": ["192.0.2.3"], "labels": {"__type": "ICMP"}}]`, `"v2"`)
+	if !sc.RefreshHTTPSD(logger) {
+		t.Error("refresh: new target list not reported as changed")
+	}
+	if got := targetNames(sc.httpSDTargets(logger, sc.Cfg.Conf.HTTPSD, Targets{})); got != "192.0.2.3" {
+		t.Errorf("targets: got %s", got)
+	}
+}
+
+func TestHTTPSDKeepLastGood(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{name: "server error", status: http.StatusInternalServerError, body: "error"},
+		{name: "malformed body", status: http.StatusOK, body: `[{"targets": [`},
+		{name: "invalid group", status: http.StatusOK, body: `[{"targets": ["192.0.2.3"]}]`},
+		{name: "too large", status: http.StatusOK, body: strings.Repeat(" ", httpSDMaxSize+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &sdServer{}
+			srv.set(http.StatusOK, sdGroups, "")
+			ts := httptest.NewServer(srv)
+			defer ts.Close()
+
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			sc := newSDConfig(t, ts.URL)
+			sc.httpSDTargets(logger, sc.Cfg.Conf.HTTPSD, Targets{})
+
+			srv.set(tt.status, tt.body, "")
+			if sc.RefreshHTTPSD(logger) {
+				t.Error("refresh: failed refresh reported as changed")
+			}
+			if f := sc.SDRefreshFailures()["http"]; f != 1 {
+				t.Errorf("failures: got %v, want 1", f)
+			}
+			if got := targetNames(sc.httpSDTargets(logger, sc.Cfg.Conf.HTTPSD, Targets{})); got != "192.0.2.1,192.0.2.2" {
+				t.Errorf("targets: got %s, want the last good list", got)
+			}
+		})
+	}
+}
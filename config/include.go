@@ -0,0 +1,224 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// envVar Environment variable reference ${VAR}, $${VAR} is the escaped literal ${VAR}
+var envVar = regexp.MustCompile(`\$?\$\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+// fragment Config file included by the include globs
+type fragment struct {
+	Templates map[string]Target `yaml:"templates"`
+	Targets   Targets           `yaml:"targets"`
+}
+
+// include Included config file, its raw data locates the targets
+type include struct {
+	file string
+	raw  []byte
+	data []byte
+}
+
+// expandEnv replaces the ${VAR} environment variables in the scalar values of the config, an undefined variable is an error
+// The comments and keys are left as is and the expanded values are quoted when needed, a value can't change the structure of the config
+func expandEnv(data []byte) ([]byte, error) {
+	if !envVar.Match(data) {
+		return data, nil
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("unmarshaling config: %s", err)
+	}
+	// The variables are expanded even if one is undefined, to report the other errors of the config
+	err := expandNode(&root)
+	if root.Kind == 0 {
+		return data, err
+	}
+	expanded, mErr := yaml.Marshal(&root)
+	if mErr != nil {
+		return nil, fmt.Errorf("marshaling config: %s", mErr)
+	}
+	return expanded, err
+}
+
+// expandNode expands the environment variables of the scalar values of a node and its children, the first error is returned
+func expandNode(n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		var err error
+		for _, c := range n.Content {
+			if cErr := expandNode(c); cErr != nil && err == nil {
+				err = cErr
+			}
+		}
+		return err
+	case yaml.MappingNode:
+		var err error
+		for i := 1; i < len(n.Content); i += 2 {
+			if cErr := expandNode(n.Content[i]); cErr != nil && err == nil {
+				err = cErr
+			}
+		}
+		return err
+	case yaml.ScalarNode:
+		if !envVar.MatchString(n.Value) {
+			return nil
+		}
+		var err error
+		n.Value = envVar.ReplaceAllStringFunc(n.Value, func(m string) string {
+			if strings.HasPrefix(m, "$$") {
+				return m[1:]
+			}
+			name := envVar.FindStringSubmatch(m)[1]
+			value, found := os.LookupEnv(name)
+			if !found && err == nil {
+				err = fmt.Errorf("line %d: undefined environment variable: %s", n.Line, name)
+			}
+			return value
+		})
+		// The type of a plain value is resolved from its expanded value (port: ${PORT})
+		if n.Style == 0 {
+			n.Tag = ""
+		}
+		return err
+	}
+	return nil
+}
+
+// readIncludes reads and expands the files of the include globs, relative globs are resolved from the config file directory
+func (c *Config) readIncludes(confFile string) ([]include, error) {
+	includes := []include{}
+	for i, pattern := range c.Include {
+		if !filepath.IsAbs(pattern) && !isHTTPURL(confFile) {
+			pattern = filepath.Join(filepath.Dir(confFile), pattern)
+			c.Include[i] = pattern
+		}
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("include %s: %s", pattern, err)
+		}
+
+		for _, file := range files {
+			raw, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("include %s: %s", file, err)
+			}
+			data, err := expandEnv(raw)
+			if err != nil {
+				return nil, fmt.Errorf("include %s: %s", file, err)
+			}
+			includes = append(includes, include{file: file, raw: raw, data: data})
+		}
+	}
+	return includes, nil
+}
+
+// decode parses an included file, unknown fields are rejected
+func (i include) decode() (*fragment, error) {
+	f := &fragment{}
+	dec := yaml.NewDecoder(bytes.NewReader(i.data))
+	dec.KnownFields(true)
+	if err := dec.Decode(f); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("include %s: %s", i.file, err)
+	}
+	return f, nil
+}
+
+// mergeInclude appends the templates and targets of an included file
+func (c *Config) mergeInclude(file string, f *fragment, templateFiles map[string]string) error {
+	for name, tmpl := range f.Templates {
+		if src, found := templateFiles[name]; found {
+			return fmt.Errorf("include %s: template %s already defined in %s", file, name, src)
+		}
+		if c.Templates == nil {
+			c.Templates = map[string]Target{}
+		}
+		c.Templates[name] = tmpl
+		templateFiles[name] = file
+	}
+	c.Targets = append(c.Targets, f.Targets...)
+	return nil
+}
+
+// loadIncludes merges the included files and returns the file where each target is defined
+func (c *Config) loadIncludes(confFile string) ([]string, error) {
+	origins := make([]string, len(c.Targets))
+	for i := range origins {
+		origins[i] = confFile
+	}
+	templateFiles := map[string]string{}
+	for name := range c.Templates {
+		templateFiles[name] = confFile
+	}
+
+	includes, err := c.readIncludes(confFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range includes {
+		f, err := i.decode()
+		if err != nil {
+			return nil, err
+		}
+		if err := c.mergeInclude(i.file, f, templateFiles); err != nil {
+			return nil, err
+		}
+		for range f.Targets {
+			origins = append(origins, i.file)
+		}
+	}
+	return origins, nil
+}
+
+// applyTemplates sets the fields of the targets that reference a template
+func (c *Config) applyTemplates(origins []string) error {
+	for i := range c.Targets {
+		t := &c.Targets[i]
+		if t.Template == "" {
+			continue
+		}
+		tmpl, found := c.Templates[t.Template]
+		if !found {
+			return fmt.Errorf("%s: target %s: unknown template %s", origins[i], t.Name, t.Template)
+		}
+		t.applyTemplate(tmpl)
+	}
+	return nil
+}
+
+// applyTemplate sets the fields of the target that are not set from its template, the labels are merged
+func (t *Target) applyTemplate(tmpl Target) {
+	if len(tmpl.Labels.Kv) > 0 {
+		labels := map[string]string{}
+		for k, v := range tmpl.Labels.Kv {
+			labels[k] = v
+		}
+		for k, v := range t.Labels.Kv {
+			labels[k] = v
+		}
+		t.Labels.Kv = labels
+	}
+
+	dst := reflect.ValueOf(t).Elem()
+	src := reflect.ValueOf(tmpl)
+	for i := 0; i < dst.NumField(); i++ {
+		switch dst.Type().Field(i).Name {
+		case "Name", "Template", "Labels":
+			continue
+		}
+		if dst.Field(i).IsZero() {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/creasty/defaults"
+	"github.com/syepes/network_exporter/pkg/common"
+)
+
+// Mesh Group of probes that check each other (full mesh)
+type Mesh struct {
+	Name            string            `yaml:"name" json:"name"`
+	Type            string            `yaml:"type" json:"type" default:"ICMP"`
+	Port            string            `yaml:"port,omitempty" json:"port,omitempty"`
+	Peers           []string          `yaml:"peers" json:"peers"`
+	PeersDNS        []string          `yaml:"peers_dns" json:"peers_dns"`
+	RefreshInterval duration          `yaml:"refresh_interval" json:"refresh_interval" default:"60s"`
+	Labels          map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+}
+
+// meshState Peers of the mesh groups resolved from DNS, kept between the config reloads
+type meshState struct {
+	mtx    sync.Mutex
+	groups map[string]*meshGroup
+}
+
+// meshGroup Last resolved peers of a mesh group
+type meshGroup struct {
+	peers       []string
+	lastRefresh time.Time
+}
+
+// meshTimeout DNS timeout of the mesh peers resolution
+const meshTimeout = 5 * time.Second
+
+// validateMesh checks the mesh groups
+func (c *Config) validateMesh() error {
+	names := map[string]bool{}
+	for _, m := range c.Mesh {
+		if m.Name == "" {
+			return fmt.Errorf("mesh: name is required")
+		}
+		if names[m.Name] {
+			return fmt.Errorf("mesh %s: duplicated name", m.Name)
+		}
+		names[m.Name] = true
+
+		if m.Type != "ICMP" && m.Type != "MTR" && m.Type != "ICMP+MTR" && m.Type != "TCP" {
+			return fmt.Errorf("mesh %s: type must be 'ICMP', 'MTR', 'ICMP+MTR' or 'TCP'", m.Name)
+		}
+		if m.Type == "TCP" {
+			if _, err := common.ExpandPorts(m.Port); err != nil || m.Port == "" {
+				return fmt.Errorf("mesh %s: port is required by the TCP type", m.Name)
+			}
+		}
+		if len(m.Peers) == 0 && len(m.PeersDNS) == 0 {
+			return fmt.Errorf("mesh %s: peers or peers_dns is required", m.Name)
+		}
+		if m.RefreshInterval <= 0 {
+			return fmt.Errorf("mesh %s: refresh_interval must be >0", m.Name)
+		}
+	}
+	return nil
+}
+
+// RefreshMesh resolves the DNS peers of the mesh groups whose refresh interval has elapsed and reports if any peer list has changed
+func (sc *SafeConfig) RefreshMesh(logger *slog.Logger) bool {
+	sc.RLock()
+	groups := sc.Cfg.Mesh
+	sc.RUnlock()
+
+	changed := false
+	for _, m := range groups {
+		if len(m.PeersDNS) == 0 {
+			continue
+		}
+		sc.mesh.mtx.Lock()
+		g, found := sc.mesh.groups[m.Name]
+		due := !found || time.Since(g.lastRefresh) >= m.RefreshInterval.Duration()
+		sc.mesh.mtx.Unlock()
+		if !due {
+			continue
+		}
+
+		updated, err := sc.resolveMesh(m)
+		if err != nil {
+			logger.Error("Resolving mesh peers, keeping the last peers", "type", "Config", "func", "RefreshMesh", "mesh", m.Name, "err", err)
+			continue
+		}
+		if updated {
+			logger.Info("Mesh peers changed", "type", "Config", "func", "RefreshMesh", "mesh", m.Name)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// resolveMesh resolves the DNS peers of a mesh group (SRV or A/AAAA records), on error the last peers are kept
+func (sc *SafeConfig) resolveMesh(m Mesh) (bool, error) {
+	sc.mesh.mtx.Lock()
+	if sc.mesh.groups == nil {
+		sc.mesh.groups = map[string]*meshGroup{}
+	}
+	g, found := sc.mesh.groups[m.Name]
+	if !found {
+		g = &meshGroup{}
+		sc.mesh.groups[m.Name] = g
+	}
+	g.lastRefresh = time.Now()
+	sc.mesh.mtx.Unlock()
+
+	peers := []string{}
+	for _, name := range m.PeersDNS {
+		resolved, err := resolvePeers(name)
+		if err != nil {
+			return false, err
+		}
+		for _, p := range resolved {
+			peers = common.AppendIfMissing(peers, p)
+		}
+	}
+	sort.Strings(peers)
+
+	sc.mesh.mtx.Lock()
+	defer sc.mesh.mtx.Unlock()
+	if reflect.DeepEqual(g.peers, peers) {
+		return false, nil
+	}
+	g.peers = peers
+	return true, nil
+}
+
+// resolvePeers returns the hosts of a SRV record (_service._proto.name) or the IPs of an A/AAAA record
+func resolvePeers(name string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), meshTimeout)
+	defer cancel()
+
+	if common.SrvRecordCheck(name) {
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+		hosts := []string{}
+		for _, r := range records {
+			hosts = append(hosts, strings.TrimSuffix(r.Target, "."))
+		}
+		return hosts, nil
+	}
+	return net.DefaultResolver.LookupHost(ctx, name)
+}
+
+// meshTargets returns the targets towards all the peers of the mesh groups except this probe, named <mesh>-<peer>
+// The targets are labelled with the source (src_probe) and destination (dst_probe) probes, the groups that were never resolved are resolved first
+func (sc *SafeConfig) meshTargets(logger *slog.Logger, hostname string, groups []Mesh) Targets {
+	local := localAddrs()
+	targets := Targets{}
+	for _, m := range groups {
+		peers := append([]string{}, m.Peers...)
+		if len(m.PeersDNS) > 0 {
+			sc.mesh.mtx.Lock()
+			_, found := sc.mesh.groups[m.Name]
+			sc.mesh.mtx.Unlock()
+			if !found {
+				if _, err := sc.resolveMesh(m); err != nil {
+					logger.Error("Resolving mesh peers", "type", "Config", "func", "meshTargets", "mesh", m.Name, "err", err)
+				}
+			}
+
+			sc.mesh.mtx.Lock()
+			peers = append(peers, sc.mesh.groups[m.Name].peers...)
+			sc.mesh.mtx.Unlock()
+		}
+
+		seen := map[string]bool{}
+		for _, peer := range peers {
+			if seen[peer] || isSelf(peer, hostname, local) {
+				continue
+			}
+			seen[peer] = true
+
+			t := Target{
+				Name:   m.Name + "-" + peer,
+				Host:   peer,
+				Type:   m.Type,
+				Labels: extraKV{Kv: map[string]string{}},
+			}
+			if m.Type == "TCP" {
+				t.Host = peer + ":" + m.Port
+			}
+			for k, v := range m.Labels {
+				t.Labels.Kv[k] = v
+			}
+			t.Labels.Kv["src_probe"] = hostname
+			t.Labels.Kv["dst_probe"] = peer
+			if err := defaults.Set(&t); err != nil {
+				logger.Error("Skipping mesh target", "type", "Config", "func", "meshTargets", "mesh", m.Name, "peer", peer, "err", err)
+				continue
+			}
+			targets = append(targets, t)
+		}
+	}
+
+	// Drop the groups that are no longer configured
+	sc.mesh.mtx.Lock()
+	for name := range sc.mesh.groups {
+		configured := false
+		for _, m := range groups {
+			if m.Name == name && len(m.PeersDNS) > 0 {
+				configured = true
+				break
+			}
+		}
+		if !configured {
+			delete(sc.mesh.groups, name)
+		}
+	}
+	sc.mesh.mtx.Unlock()
+
+	return targets
+}
+
+// isSelf checks if a peer is this probe, by its exact hostname or its IPs (the peer names are resolved)
+// The names are never compared by their first label, the same short hostname can be used in other domains
+func isSelf(peer string, hostname string, local []string) bool {
+	peer = strings.TrimSuffix(peer, ".")
+	if strings.EqualFold(peer, hostname) || common.ContainsString(local, peer) {
+		return true
+	}
+	if net.ParseIP(peer) != nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), meshTimeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupHost(ctx, peer)
+	if err != nil {
+		return false
+	}
+	for _, ip := range ips {
+		if common.ContainsString(local, ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// localAddrs returns the IPs of the local interfaces
+func localAddrs() []string {
+	local := []string{}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return local
+	}
+	for _, a := range addrs {
+		if ipNet, ok := a.(*net.IPNet); ok {
+			local = append(local, ipNet.IP.String())
+		}
+	}
+	return local
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/syepes/network_exporter/pkg/common"
+)
+
+// Probe Exporter instance that runs the targets, identified by its hostname
+type Probe struct {
+	Name   string            `yaml:"name" json:"name"`
+	Labels map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+}
+
+// matcher Probe label matcher (=, !=, =~, !~)
+type matcher struct {
+	name  string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+// ParseLabels parses a list of labels (region=eu,site=fra)
+func ParseLabels(s string) (map[string]string, error) {
+	labels := map[string]string{}
+	if s == "" {
+		return labels, nil
+	}
+	for _, l := range strings.Split(s, ",") {
+		name, value, found := strings.Cut(l, "=")
+		if !found || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("expected NAME=VALUE got '%s'", l)
+		}
+		labels[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return labels, nil
+}
+
+// parseSelector parses a probe label selector (region=eu,site=~fra-.*,env!=lab)
+func parseSelector(s string) ([]matcher, error) {
+	matchers := []matcher{}
+	if s == "" {
+		return matchers, nil
+	}
+	for _, m := range strings.Split(s, ",") {
+		i := strings.IndexAny(m, "=!")
+		if i < 1 {
+			return nil, fmt.Errorf("invalid matcher: %s", m)
+		}
+		mt := matcher{name: strings.TrimSpace(m[:i])}
+		rest := m[i:]
+		for _, op := range []string{"=~", "!~", "!=", "="} {
+			if strings.HasPrefix(rest, op) {
+				mt.op = op
+				mt.value = strings.TrimSpace(rest[len(op):])
+				break
+			}
+		}
+		if mt.op == "" {
+			return nil, fmt.Errorf("invalid matcher: %s", m)
+		}
+		if mt.op == "=~" || mt.op == "!~" {
+			re, err := regexp.Compile("^(?:" + mt.value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid matcher: %s: %s", m, err)
+			}
+			mt.re = re
+		}
+		matchers = append(matchers, mt)
+	}
+	return matchers, nil
+}
+
+// matches checks the matcher against the labels of a probe, its hostname is available as the hostname label
+func (m matcher) matches(p Probe) bool {
+	value := p.Labels[m.name]
+	if m.name == "hostname" {
+		value = p.Name
+	}
+	switch m.op {
+	case "=":
+		return value == m.value
+	case "!=":
+		return value != m.value
+	case "=~":
+		return m.re.MatchString(value)
+	default:
+		return !m.re.MatchString(value)
+	}
+}
+
+// assignment Compiled probe assignment settings of a target
+type assignment struct {
+	probes   []*regexp.Regexp
+	selector []matcher
+	count    int
+}
+
+// newAssignment compiles the probe assignment settings of a target, the probe hostnames are anchored regexes
+func newAssignment(t Target) (*assignment, error) {
+	if *t.ProbeCount < 0 {
+		return nil, fmt.Errorf("probe_count must be >=0")
+	}
+	selector, err := parseSelector(t.ProbeSelector)
+	if err != nil {
+		return nil, fmt.Errorf("probe_selector: %s", err)
+	}
+	a := &assignment{selector: selector, count: *t.ProbeCount}
+	for _, p := range t.Probe {
+		re, err := regexp.Compile("^(?:" + p + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("probe: %s", err)
+		}
+		a.probes = append(a.probes, re)
+	}
+	return a, nil
+}
+
+// validateAssignment checks the probe assignment settings of a target
+func validateAssignment(t Target) error {
+	_, err := newAssignment(t)
+	return err
+}
+
+// eligible checks if a probe can run the target, the probe hostnames are matched as exact names or anchored regexes
+func (a *assignment) eligible(p Probe) bool {
+	if len(a.probes) > 0 {
+		found := false
+		for _, re := range a.probes {
+			if re.MatchString(p.Name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, m := range a.selector {
+		if !m.matches(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// assigned checks if the target runs on this probe (self)
+// With probe_count the target runs on the N eligible probes of the `probes` list chosen by rendezvous hashing of the target name
+// The eligibility is only taken from the shared list so every probe takes the same decision, a probe that is not listed doesn't run the target
+func (a *assignment) assigned(name string, self Probe, probes []Probe) bool {
+	if a.count == 0 {
+		return a.eligible(self)
+	}
+
+	candidates := []string{}
+	for _, p := range probes {
+		if a.eligible(p) {
+			candidates = common.AppendIfMissing(candidates, p.Name)
+		}
+	}
+	return common.ContainsString(common.Rendezvous(name, candidates, a.count), self.Name)
+}
+
+// validateProbes checks the probes list, every probe needs a unique name and the probe_count targets need the list
+func (c *Config) validateProbes() error {
+	names := map[string]bool{}
+	for _, p := range c.Probes {
+		if p.Name == "" {
+			return fmt.Errorf("probes: name is required")
+		}
+		if names[p.Name] {
+			return fmt.Errorf("probes: duplicated name %s", p.Name)
+		}
+		names[p.Name] = true
+	}
+	for _, t := range c.Targets {
+		if *t.ProbeCount > 0 && len(c.Probes) == 0 {
+			return fmt.Errorf("target %s: probe_count requires the probes list", t.Name)
+		}
+	}
+	return nil
+}
+
+// probeSelf returns this probe, its labels are taken from `probes` and the probe labels flag (flag first)
+// The probe_count targets only run on the listed probes, a warning is logged if this probe is not listed
+func (c *Config) probeSelf(logger *slog.Logger, hostname string, labels map[string]string) Probe {
+	self := Probe{Name: hostname, Labels: map[string]string{}}
+	listed := false
+	for _, p := range c.Probes {
+		if p.Name == hostname {
+			listed = true
+			for k, v := range p.Labels {
+				self.Labels[k] = v
+			}
+		}
+	}
+	if !listed {
+		for _, t := range c.Targets {
+			if *t.ProbeCount > 0 {
+				logger.Warn("This probe is not listed in probes, the probe_count targets don't run on it", "type", "Config", "func", "probeSelf", "probe", hostname)
+				break
+			}
+		}
+	}
+	for k, v := range labels {
+		self.Labels[k] = v
+	}
+	return self
+}
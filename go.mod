@@ -9,7 +9,7 @@ require (
 	github.com/prometheus/common v0.66.1
 	github.com/prometheus/procfs v0.17.0 // indirect
 	golang.org/x/net v0.44.0
-	golang.org/x/sys v0.36.0 // indirect
+	golang.org/x/sys v0.36.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -18,6 +18,8 @@ require (
 	github.com/creasty/defaults v1.8.0
 	github.com/felixge/fgprof v0.9.5
 	github.com/prometheus/exporter-toolkit v0.14.1
+	github.com/quic-go/quic-go v0.59.1
+	golang.org/x/oauth2 v0.31.0
 )
 
 require (
@@ -32,10 +34,10 @@ require (
 	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
 	github.com/mwitkow/go-conntrack v0.0.0-20190716064945-2f068394615f // indirect
 	github.com/prometheus/client_model v0.6.2 // indirect
+	github.com/quic-go/qpack v0.6.0 // indirect
 	github.com/xhit/go-str2duration/v2 v2.1.0 // indirect
 	go.yaml.in/yaml/v2 v2.4.3 // indirect
 	golang.org/x/crypto v0.42.0 // indirect
-	golang.org/x/oauth2 v0.31.0 // indirect
 	golang.org/x/sync v0.17.0 // indirect
 	golang.org/x/text v0.29.0 // indirect
 	google.golang.org/protobuf v1.36.10 // indirect
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"expvar"
 	"fmt"
 	"log/slog"
@@ -9,7 +10,9 @@ import (
 	"net/http"
 	"net/http/pprof"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/alecthomas/kingpin/v2"
@@ -23,7 +26,10 @@ import (
 	"github.com/syepes/network_exporter/collector"
 	"github.com/syepes/network_exporter/config"
 	"github.com/syepes/network_exporter/monitor"
+	"github.com/syepes/network_exporter/pkg/cluster"
 	"github.com/syepes/network_exporter/pkg/common"
+	"github.com/syepes/network_exporter/pkg/mtr"
+	"github.com/syepes/network_exporter/pkg/watch"
 )
 
 const version string = "1.8.0"
@@ -34,8 +40,12 @@ var (
 	enableIpv6         = kingpin.Flag("ipv6", "ipv6 Enable").Default("true").Bool()
 	WebMetricPath      = kingpin.Flag("web.metrics.path", "metric path").Default("/metrics").String()
 	WebConfigFile      = kingpin.Flag("web.config.file", "Path to the web configuration file").Default("").String()
-	configFile         = kingpin.Flag("config.file", "Exporter configuration file").Default("/app/cfg/network_exporter.yml").String()
+	WebEnableReload    = kingpin.Flag("web.enable-reload", "Enable the config reload endpoint (POST /-/reload)").Default("false").Bool()
+	configFile         = kingpin.Flag("config.file", "Exporter configuration file").Default("/app/cfg/network_exporter.yml").IsSetByUser(&configFileSet).String()
 	configFileHeaders  = HTTPHeader(kingpin.Flag("config.file.header", "Headers for loading configuration file from URL"))
+	configFileWatch    = kingpin.Flag("config.file.watch", "Reload the configuration when the file changes").Default("true").Bool()
+	probeLabels        = ProbeLabels(kingpin.Flag("probe.labels", "Labels of this probe used by the target probe_selector (region=eu,site=fra)"))
+	clusterInstanceID  = kingpin.Flag("cluster.instance-id", "Unique ID of this instance in the cluster, returned by /-/healthy (default: hostname and listen port)").Default("").String()
 	enableProfileing   = kingpin.Flag("profiling", "Enable Profiling (pprof + fgprof)").Default("false").Bool()
 	// SCALING: maxConcurrentJobs controls how many probe operations can run concurrently per target.
 	// Higher values increase throughput but consume more resources (memory, CPU, file descriptors).
@@ -46,6 +56,7 @@ var (
 	//   - Large deployments (>1000 targets): 1-2
 	maxConcurrentJobs = kingpin.Flag("max-concurrent-jobs", "Maximum concurrent probe operations per target (affects memory and CPU usage)").Default("3").Int()
 	sc                = &config.SafeConfig{Cfg: &config.Config{}}
+	command           string
 	logger            *slog.Logger
 	// SCALING: icmpID is a shared counter across all PING and MTR targets (see pkg/common/type.go for limits)
 	icmpID         *common.IcmpID
@@ -53,8 +64,11 @@ var (
 	monitorMTR     *monitor.MTR
 	monitorTCP     *monitor.TCPPort
 	monitorHTTPGet *monitor.HTTPGet
+	// reloadMtx serializes the config reloads (refresh, signal, file changes, http_sd, cluster and mesh)
+	reloadMtx sync.Mutex
+	fileWatch *watch.Watcher
 
-	indexHTML = `<!doctype html><html><head> <meta charset="UTF-8"><title>Network Exporter (Version ` + version + `)</title></head><body><h1>Network Exporter</h1><p><a href="%s">Metrics</a></p></body></html>`
+	indexHTML = `<!doctype html><html><head> <meta charset="UTF-8"><title>Network Exporter (Version ` + version + `)</title></head><body><h1>Network Exporter</h1><p><a href="%s">Metrics</a></p><p>MTR Report: /mtr?target=&lt;name&gt;[&amp;format=text] (POST with &amp;run=1 for a new MTR)</p><p>Config Reload: POST /-/reload</p><p>Health: /-/healthy</p></body></html>`
 )
 
 type HTTPHeaderValue http.Header
@@ -77,19 +91,48 @@ func HTTPHeader(s kingpin.Settings) (target *http.Header) {
 	return
 }
 
+type ProbeLabelsValue map[string]string
+
+func (l *ProbeLabelsValue) Set(input string) error {
+	labels, err := config.ParseLabels(input)
+	if err != nil {
+		return err
+	}
+	for k, v := range labels {
+		(*l)[k] = v
+	}
+	return nil
+}
+
+func (l *ProbeLabelsValue) String() string {
+	return ""
+}
+func ProbeLabels(s kingpin.Settings) (target *map[string]string) {
+	target = &map[string]string{}
+	s.SetValue((*ProbeLabelsValue)(target))
+	return
+}
+
 func init() {
 	promslogConfig := &promslog.Config{}
 	flag.AddFlags(kingpin.CommandLine, promslogConfig)
 	kingpin.Version(version)
 	kingpin.HelpFlag.Short('h')
-	kingpin.Parse()
+	command = kingpin.Parse()
 	logger = promslog.New(promslogConfig)
 	icmpID = &common.IcmpID{}
+	sc.ProbeLabels = *probeLabels
 }
 
 func main() {
+	if command != serveCmd.FullCommand() {
+		os.Exit(runCommand(command))
+	}
+
 	logger.Info("msg", "Starting network_exporter", "version", version)
 
+	sc.Cluster = cluster.New(logger, instanceID())
+
 	logger.Info("msg", "Loading config")
 	if err := sc.ReloadConfig(logger, *configFile, *configFileHeaders); err != nil {
 		logger.Error("msg", "Loading config", "err", err)
@@ -109,10 +152,14 @@ func main() {
 	monitorTCP = monitor.NewTCPPort(logger, sc, resolver, *enableIpv6, *maxConcurrentJobs)
 	go monitorTCP.AddTargets()
 
-	monitorHTTPGet = monitor.NewHTTPGet(logger, sc, resolver, *maxConcurrentJobs)
+	monitorHTTPGet = monitor.NewHTTPGet(logger, sc, resolver, *enableIpv6, *maxConcurrentJobs)
 	go monitorHTTPGet.AddTargets()
 
 	go startConfigRefresh()
+	go startFileWatch()
+	go startHTTPSDRefresh()
+	go startClusterWatch()
+	go startMeshRefresh()
 
 	startServer()
 }
@@ -127,25 +174,120 @@ func startConfigRefresh() {
 	defer ticker.Stop()
 
 	for range ticker.C {
-		logger.Info("msg", "ReLoading config")
-		if err := sc.ReloadConfig(logger, *configFile, *configFileHeaders); err != nil {
-			logger.Error("msg", "Reloading config skipped", "err", err)
-			continue
+		reloadConfig("refresh")
+	}
+}
+
+// startFileWatch reloads the config when the config file, the included files or the target files change
+func startFileWatch() {
+	w, err := watch.New(logger)
+	if err != nil {
+		logger.Error("Config watch disabled", "type", "Main", "func", "startFileWatch", "err", err)
+		return
+	}
+	reloadMtx.Lock()
+	fileWatch = w
+	w.Set(watchDirs())
+	reloadMtx.Unlock()
+
+	for range w.Events() {
+		reloadConfig("file_change")
+	}
+}
+
+// watchDirs returns the directories of the config file, the included files and the target files
+// The directory of the config file is watched to follow the editors and Kubernetes ConfigMaps that replace the file (symlink swap)
+func watchDirs() []string {
+	dirs := []string{}
+	if *configFileWatch && !strings.HasPrefix(*configFile, "http://") && !strings.HasPrefix(*configFile, "https://") {
+		if path, err := filepath.Abs(*configFile); err == nil {
+			dirs = append(dirs, filepath.Dir(path))
+		}
+	}
+
+	sc.RLock()
+	defer sc.RUnlock()
+	for _, d := range sc.Cfg.WatchDirs() {
+		dirs = common.AppendIfMissing(dirs, d)
+	}
+	return dirs
+}
+
+// startHTTPSDRefresh reloads the config when the target list of an HTTP SD source changes
+func startHTTPSDRefresh() {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if sc.RefreshHTTPSD(logger) {
+			reloadConfig("http_sd")
+		}
+	}
+}
+
+// startMeshRefresh reloads the config when the DNS peers of a mesh group change
+func startMeshRefresh() {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if sc.RefreshMesh(logger) {
+			reloadConfig("mesh")
 		}
-		monitorPING.DelTargets()
-		_ = monitorPING.CheckActiveTargets()
-		monitorPING.AddTargets()
-		monitorMTR.DelTargets()
-		_ = monitorMTR.CheckActiveTargets()
-		monitorMTR.AddTargets()
-		monitorTCP.DelTargets()
-		_ = monitorTCP.CheckActiveTargets()
-		monitorTCP.AddTargets()
-		monitorHTTPGet.DelTargets()
-		monitorHTTPGet.AddTargets()
 	}
 }
 
+// startClusterWatch reloads the config when the cluster members change, the targets are sharded again among the live members
+func startClusterWatch() {
+	for range sc.Cluster.Changes() {
+		reloadConfig("cluster")
+	}
+}
+
+// instanceID returns the ID of this instance in the cluster, by default the hostname and the port of the first listen address
+// The peers are identified by the ID they return on /-/healthy, so it only needs to be unique, not to match the peer addresses
+func instanceID() string {
+	if *clusterInstanceID != "" {
+		return *clusterInstanceID
+	}
+	hostname, _ := os.Hostname()
+	port := "9427"
+	if len(*WebListenAddresses) > 0 {
+		if _, p, err := net.SplitHostPort((*WebListenAddresses)[0]); err == nil {
+			port = p
+		}
+	}
+	return net.JoinHostPort(hostname, port)
+}
+
+// reloadConfig reloads the config and updates the running targets
+func reloadConfig(reason string) error {
+	reloadMtx.Lock()
+	defer reloadMtx.Unlock()
+
+	logger.Info("ReLoading config", "type", "Main", "func", "reloadConfig", "reason", reason)
+	if err := sc.ReloadConfig(logger, *configFile, *configFileHeaders); err != nil {
+		logger.Error("Reloading config skipped", "type", "Main", "func", "reloadConfig", "reason", reason, "err", err)
+		return err
+	}
+	monitorPING.DelTargets()
+	_ = monitorPING.CheckActiveTargets()
+	monitorPING.AddTargets()
+	monitorMTR.DelTargets()
+	_ = monitorMTR.CheckActiveTargets()
+	monitorMTR.AddTargets()
+	monitorTCP.DelTargets()
+	_ = monitorTCP.CheckActiveTargets()
+	monitorTCP.AddTargets()
+	monitorHTTPGet.DelTargets()
+	monitorHTTPGet.AddTargets()
+
+	if fileWatch != nil {
+		fileWatch.Set(watchDirs())
+	}
+	return nil
+}
+
 func startServer() {
 	mux := http.NewServeMux()
 	webMetricsPath := *WebMetricPath
@@ -157,8 +299,21 @@ func startServer() {
 	reg.MustRegister(&collector.PING{Monitor: monitorPING})
 	reg.MustRegister(&collector.TCP{Monitor: monitorTCP})
 	reg.MustRegister(&collector.HTTPGet{Monitor: monitorHTTPGet})
+	reg.MustRegister(&collector.Config{Config: sc})
 	h := promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
 	mux.Handle(webMetricsPath, h)
+	mux.HandleFunc("/mtr", mtrReport)
+	mux.HandleFunc("/-/healthy", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(cluster.InstanceHeader, sc.Cluster.Self())
+		fmt.Fprint(w, "OK")
+	})
+	if *WebEnableReload {
+		mux.HandleFunc("/-/reload", reloadHandler)
+	} else {
+		mux.HandleFunc("/-/reload", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Config reload endpoint is not enabled (--web.enable-reload)", http.StatusForbidden)
+		})
+	}
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, indexHTML, webMetricsPath)
 	})
@@ -205,6 +360,70 @@ func getResolver() *config.Resolver {
 	return &config.Resolver{Resolver: &net.Resolver{PreferGo: true, Dial: dialer}, Timeout: sc.Cfg.Conf.NameserverTimeout.Duration()}
 }
 
+// mtrReport returns the MTR results of a target as JSON or as the mtr console table (format=text), run=1 executes a new MTR (POST only)
+func mtrReport(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("target")
+	if name == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+
+	var result *mtr.MtrResult
+	var found bool
+	if r.URL.Query().Get("run") == "1" {
+		// On-demand runs send probes, they are only executed on POST requests
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "run=1 requires a POST request", http.StatusMethodNotAllowed)
+			return
+		}
+		var err error
+		result, found, err = monitorMTR.RunTarget(r.Context(), name)
+		if err != nil {
+			// No free job slot before the request ended, or a failed MTR
+			status := http.StatusInternalServerError
+			if r.Context().Err() != nil {
+				status = http.StatusServiceUnavailable
+			}
+			http.Error(w, fmt.Sprintf("running MTR: %s", err), status)
+			return
+		}
+	} else {
+		result, found = monitorMTR.ExportResult(name)
+	}
+	if !found {
+		http.Error(w, fmt.Sprintf("unknown MTR target: %s", name), http.StatusNotFound)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "Start: %v, Target: %v, DestAddr: %v\n", result.StartTime.Format("2006-01-02 15:04:05"), name, result.DestAddr)
+		fmt.Fprint(w, mtr.Report(result))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		logger.Error("Failed to encode MTR report", "func", "mtrReport", "target", name, "err", err)
+	}
+}
+
+// reloadHandler runs the same reload sequence as SIGHUP, the validation error is returned in the response body
+func reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := reloadConfig("http"); err != nil {
+		http.Error(w, fmt.Sprintf("reloading config: %s", err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintln(w, "OK")
+}
+
 func expVars(w http.ResponseWriter, r *http.Request) {
 	first := true
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -1,6 +1,7 @@
 package monitor
 
 import (
+	"encoding/json"
 	"strings"
 
 	"github.com/syepes/network_exporter/config"
@@ -16,3 +17,48 @@ func countTargets(sc *config.SafeConfig, target string) (count int) {
 	}
 	return count
 }
+
+// targetSpec returns the effective settings of a target, the target definition and the global settings of its type
+func targetSpec(t config.Target, settings interface{}) string {
+	// The type and probe don't change how the target is monitored once it's assigned to this monitor and host
+	t.Type = ""
+	t.Probe = nil
+	spec, _ := json.Marshal(struct {
+		Target   config.Target
+		Settings interface{}
+	}{t, settings})
+	return string(spec)
+}
+
+// diffSpecs records the specs of the configured targets and returns the names of the targets whose spec changed
+func diffSpecs(specs map[string]string, targets config.Targets, match func(config.Target) bool, settings interface{}) map[string]bool {
+	changed := map[string]bool{}
+	configured := map[string]bool{}
+	for _, t := range targets {
+		if !match(t) {
+			continue
+		}
+		configured[t.Name] = true
+		spec := targetSpec(t, settings)
+		if old, found := specs[t.Name]; found && old != spec {
+			changed[t.Name] = true
+		}
+		specs[t.Name] = spec
+	}
+
+	for name := range specs {
+		if !configured[name] {
+			delete(specs, name)
+		}
+	}
+	return changed
+}
+
+// changedTarget reports if a running target belongs to one of the changed targets
+// The sub targets ("name ip [port]") are matched by their recorded parent target, the other targets by their name
+func changedTarget(changed map[string]bool, parents map[string]string, key string) bool {
+	if parent, found := parents[key]; found {
+		return changed[parent]
+	}
+	return changed[key]
+}
@@ -1,8 +1,10 @@
 package monitor
 
 import (
+	"context"
 	"log/slog"
 	"math/rand"
+	"net"
 	"net/url"
 	"os"
 	"sync"
@@ -21,13 +23,16 @@ type HTTPGet struct {
 	resolver          *config.Resolver
 	interval          time.Duration
 	timeout           time.Duration
+	ipv6              bool
 	maxConcurrentJobs int
 	targets           map[string]*target.HTTPGet
+	parents           map[string]string
+	specs             map[string]string
 	mtx               sync.RWMutex
 }
 
 // NewHTTPGet creates and configures a new Monitoring HTTPGet instance
-func NewHTTPGet(logger *slog.Logger, sc *config.SafeConfig, resolver *config.Resolver, maxConcurrentJobs int) *HTTPGet {
+func NewHTTPGet(logger *slog.Logger, sc *config.SafeConfig, resolver *config.Resolver, ipv6 bool, maxConcurrentJobs int) *HTTPGet {
 	if logger == nil {
 		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
 	}
@@ -37,8 +42,11 @@ func NewHTTPGet(logger *slog.Logger, sc *config.SafeConfig, resolver *config.Res
 		resolver:          resolver,
 		interval:          sc.Cfg.HTTPGet.Interval.Duration(),
 		timeout:           sc.Cfg.HTTPGet.Timeout.Duration(),
+		ipv6:              ipv6,
 		maxConcurrentJobs: maxConcurrentJobs,
 		targets:           make(map[string]*target.HTTPGet),
+		parents:           make(map[string]string),
+		specs:             make(map[string]string),
 	}
 }
 
@@ -56,56 +64,149 @@ func (p *HTTPGet) Stop() {
 func (p *HTTPGet) AddTargets() {
 	p.logger.Debug("Current Targets", "type", "HTTPGet", "func", "AddTargets", "count", len(p.targets), "configured", countTargets(p.sc, "HTTPGet"))
 
+	// The targets whose settings changed are added again (restarted)
+	changed := p.update()
+
 	targetActiveTmp := []string{}
 	for _, v := range p.targets {
+		if changedTarget(changed, p.parents, v.Name()) {
+			continue
+		}
 		targetActiveTmp = common.AppendIfMissing(targetActiveTmp, v.Name())
 	}
 
+	// The target ips are resolved once and reused when adding the targets
+	resolved := map[string]map[string]string{}
 	targetConfigTmp := []string{}
 	for _, v := range p.sc.Cfg.Targets {
 		if v.Type == "HTTPGet" {
-			targetConfigTmp = common.AppendIfMissing(targetConfigTmp, v.Name)
+			resolved[v.Name] = p.targetIps(v, "AddTargets")
+			for targetName := range resolved[v.Name] {
+				targetConfigTmp = common.AppendIfMissing(targetConfigTmp, targetName)
+			}
 		}
 	}
 
 	targetAdd := common.CompareList(targetActiveTmp, targetConfigTmp)
 	p.logger.Debug("Target names to add", "type", "HTTPGet", "func", "AddTargets", "targets", targetAdd)
 
-	for _, targetName := range targetAdd {
-		for _, target := range p.sc.Cfg.Targets {
-			if target.Name != targetName {
+	// Build a lookup map to avoid O(n²) complexity
+	targetLookup := make(map[string]bool)
+	for _, t := range targetAdd {
+		targetLookup[t] = true
+	}
+
+	for _, target := range p.sc.Cfg.Targets {
+		if target.Type != "HTTPGet" {
+			continue
+		}
+		for targetName, ipAddr := range resolved[target.Name] {
+			if !targetLookup[targetName] {
 				continue
 			}
-			if target.Type == "HTTPGet" {
-				// Add jitter to prevent thundering herd (0-10% of interval)
-				jitter := time.Duration(rand.Int63n(int64(p.interval / 10)))
-				if target.Proxy != "" {
-					err := p.AddTargetDelayed(target.Name, target.Host, target.SourceIp, target.Proxy, target.Labels.Kv, jitter)
-					if err != nil {
-						p.logger.Warn("Skipping target", "type", "HTTPGet", "func", "AddTargets", "host", target.Host, "err", err)
-					}
-				} else {
-					err := p.AddTargetDelayed(target.Name, target.Host, target.SourceIp, "", target.Labels.Kv, jitter)
-					if err != nil {
-						p.logger.Warn("Skipping target", "type", "HTTPGet", "func", "AddTargets", "host", target.Host, "err", err)
-					}
-				}
+			// Add jitter to prevent thundering herd (0-10% of interval)
+			jitter := time.Duration(rand.Int63n(int64(p.interval / 10)))
+			err := p.addSubTarget(targetName, ipAddr, target, jitter)
+			if err != nil {
+				p.logger.Warn("Skipping target", "type", "HTTPGet", "func", "AddTargets", "host", target.Host, "ip", ipAddr, "err", err)
 			}
 		}
 	}
 }
 
-// AddTarget adds a target to the monitored list
-func (p *HTTPGet) AddTarget(name string, url string, srcAddr string, proxy string, labels map[string]string) (err error) {
-	return p.AddTargetDelayed(name, url, srcAddr, proxy, labels, 0)
+// targetIps returns the target names of a configured target mapped to their destination ip
+// With resolve_all there is one target per resolved ip of the URL host ("name ip"), otherwise a single target without ip
+func (p *HTTPGet) targetIps(t config.Target, fn string) map[string]string {
+	if !*t.ResolveAll {
+		return map[string]string{t.Name: ""}
+	}
+
+	dURL, err := url.Parse(t.Host)
+	if err != nil || dURL.Hostname() == "" {
+		p.logger.Warn("Skipping target, could not identify host", "type", "HTTPGet", "func", fn, "host", t.Host, "name", t.Name)
+		return nil
+	}
+	ipAddrs, err := common.DestAddrs(context.Background(), dURL.Hostname(), p.resolver.Resolver, p.resolver.Timeout, p.ipv6)
+	if err != nil || len(ipAddrs) == 0 {
+		p.logger.Warn("Skipping resolve target", "type", "HTTPGet", "func", fn, "host", t.Host, "err", err)
+		return nil
+	}
+
+	targets := make(map[string]string, len(ipAddrs))
+	for _, ipAddr := range ipAddrs {
+		targets[t.Name+" "+ipAddr] = ipAddr
+	}
+	return targets
+}
+
+// httpOptions maps the configured target settings to the HTTP options, the socks5 proxy destinations are resolved with resolver
+func httpOptions(t config.Target, resolver *net.Resolver) *http.HTTPOptions {
+	options := &http.HTTPOptions{
+		FollowRedirects: *t.FollowRedirects,
+		MaxRedirects:    *t.MaxRedirects,
+		HTTPVersion:     t.HTTPVersion,
+	}
+
+	if t.BasicAuth != nil || t.BearerToken != "" || t.BearerTokenFile != "" || t.OAuth2 != nil {
+		options.Auth = &http.HTTPAuth{BearerToken: t.BearerToken, BearerTokenFile: t.BearerTokenFile}
+		if t.BasicAuth != nil {
+			options.Auth.Username = t.BasicAuth.Username
+			options.Auth.Password = t.BasicAuth.Password
+			options.Auth.PasswordFile = t.BasicAuth.PasswordFile
+		}
+		if t.OAuth2 != nil {
+			options.Auth.OAuth2 = &http.OAuth2{
+				ClientID:         t.OAuth2.ClientID,
+				ClientSecret:     t.OAuth2.ClientSecret,
+				ClientSecretFile: t.OAuth2.ClientSecretFile,
+				TokenURL:         t.OAuth2.TokenURL,
+				Scopes:           t.OAuth2.Scopes,
+				EndpointParams:   t.OAuth2.EndpointParams,
+			}
+		}
+	}
+
+	if t.Proxy != "" || *t.ProxyFromEnv {
+		options.Proxy = &http.HTTPProxy{URL: t.Proxy, NoProxy: t.NoProxy, FromEnvironment: *t.ProxyFromEnv, Resolver: resolver}
+		if t.ProxyBasicAuth != nil {
+			options.Proxy.Username = t.ProxyBasicAuth.Username
+			options.Proxy.Password = t.ProxyBasicAuth.Password
+			options.Proxy.PasswordFile = t.ProxyBasicAuth.PasswordFile
+		}
+	}
+	return options
+}
+
+// update applies the global HTTPGet settings of the configuration and returns the targets whose settings changed
+func (p *HTTPGet) update() map[string]bool {
+	p.sc.RLock()
+	cfg := p.sc.Cfg
+	p.sc.RUnlock()
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.interval = cfg.HTTPGet.Interval.Duration()
+	p.timeout = cfg.HTTPGet.Timeout.Duration()
+
+	changed := diffSpecs(p.specs, cfg.Targets, func(t config.Target) bool { return t.Type == "HTTPGet" }, cfg.HTTPGet)
+	for name := range changed {
+		p.logger.Info("Restarting Target, settings changed", "type", "HTTPGet", "func", "update", "name", name)
+	}
+	return changed
+}
+
+// AddTarget adds a target to the monitored list, the URL host is resolved on every request if ip is empty
+func (p *HTTPGet) AddTarget(name string, url string, ip string, srcAddr string, options *http.HTTPOptions, labels map[string]string) (err error) {
+	return p.AddTargetDelayed(name, url, ip, srcAddr, options, labels, 0)
 }
 
 // AddTargetDelayed is AddTarget with a startup delay
-func (p *HTTPGet) AddTargetDelayed(name string, urlStr string, srcAddr string, proxy string, labels map[string]string, startupDelay time.Duration) (err error) {
-	if proxy != "" {
-		p.logger.Info("Adding Target", "type", "HTTPGet", "func", "AddTargetDelayed", "name", name, "url", urlStr, "proxy", proxy, "delay", startupDelay)
+func (p *HTTPGet) AddTargetDelayed(name string, urlStr string, ip string, srcAddr string, options *http.HTTPOptions, labels map[string]string, startupDelay time.Duration) (err error) {
+	if options != nil && options.Proxy != nil {
+		p.logger.Info("Adding Target", "type", "HTTPGet", "func", "AddTargetDelayed", "name", name, "url", urlStr, "proxy", options.Proxy.URL, "proxy_from_environment", options.Proxy.FromEnvironment, "delay", startupDelay)
 	} else {
-		p.logger.Info("Adding Target", "type", "HTTPGet", "func", "AddTargetDelayed", "name", name, "url", urlStr, "delay", startupDelay)
+		p.logger.Info("Adding Target", "type", "HTTPGet", "func", "AddTargetDelayed", "name", name, "url", urlStr, "ip", ip, "delay", startupDelay)
 	}
 
 	p.mtx.Lock()
@@ -118,14 +219,14 @@ func (p *HTTPGet) AddTargetDelayed(name string, urlStr string, srcAddr string, p
 	}
 
 	// Check Proxy URL
-	if proxy != "" {
-		_, err := url.ParseRequestURI(proxy)
+	if options != nil && options.Proxy != nil && options.Proxy.URL != "" {
+		_, err := url.ParseRequestURI(options.Proxy.URL)
 		if err != nil {
 			return err
 		}
 	}
 
-	target, err := target.NewHTTPGet(p.logger, startupDelay, name, dURL.String(), srcAddr, proxy, p.interval, p.timeout, labels, p.maxConcurrentJobs)
+	target, err := target.NewHTTPGet(p.logger, startupDelay, name, dURL.String(), ip, srcAddr, options, p.interval, p.timeout, labels, p.maxConcurrentJobs)
 	if err != nil {
 		return err
 	}
@@ -134,6 +235,17 @@ func (p *HTTPGet) AddTargetDelayed(name string, urlStr string, srcAddr string, p
 	return nil
 }
 
+// addSubTarget adds a target of the configured target t and records its parent target
+func (p *HTTPGet) addSubTarget(name string, ip string, t config.Target, startupDelay time.Duration) error {
+	if err := p.AddTargetDelayed(name, t.Host, ip, t.SourceIp, httpOptions(t, p.resolver.Resolver), t.Labels.Kv, startupDelay); err != nil {
+		return err
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.parents[name] = t.Name
+	return nil
+}
+
 // DelTargets deletes/stops the removed targets from the configuration
 func (p *HTTPGet) DelTargets() {
 	p.logger.Debug("Current Targets", "type", "HTTPGet", "func", "DelTargets", "count", len(p.targets), "configured", countTargets(p.sc, "HTTPGet"))
@@ -148,7 +260,9 @@ func (p *HTTPGet) DelTargets() {
 	targetConfigTmp := []string{}
 	for _, v := range p.sc.Cfg.Targets {
 		if v.Type == "HTTPGet" {
-			targetConfigTmp = common.AppendIfMissing(targetConfigTmp, v.Name)
+			for targetName := range p.targetIps(v, "DelTargets") {
+				targetConfigTmp = common.AppendIfMissing(targetConfigTmp, targetName)
+			}
 		}
 	}
 
@@ -181,6 +295,7 @@ func (p *HTTPGet) removeTarget(key string) {
 	}
 	target.Stop()
 	delete(p.targets, key)
+	delete(p.parents, key)
 }
 
 // Export collects the metrics for each monitored target and returns it as a simple map
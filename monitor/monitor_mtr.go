@@ -28,9 +28,13 @@ type MTR struct {
 	payloadSize       int
 	protocol          string
 	tcpPort           string
+	udpPort           string
+	udpParis          bool
+	parallel          int
 	ipv6              bool
 	maxConcurrentJobs int
 	targets           map[string]*target.MTR
+	specs             map[string]string
 	mtx               sync.RWMutex
 }
 
@@ -51,9 +55,13 @@ func NewMTR(logger *slog.Logger, sc *config.SafeConfig, resolver *config.Resolve
 		payloadSize:       sc.Cfg.MTR.PayloadSize,
 		protocol:          sc.Cfg.MTR.Protocol,
 		tcpPort:           sc.Cfg.MTR.TcpPort,
+		udpPort:           sc.Cfg.MTR.UdpPort,
+		udpParis:          sc.Cfg.MTR.UdpParis,
+		parallel:          sc.Cfg.MTR.Parallel,
 		ipv6:              ipv6,
 		maxConcurrentJobs: maxConcurrentJobs,
 		targets:           make(map[string]*target.MTR),
+		specs:             make(map[string]string),
 	}
 }
 
@@ -71,8 +79,14 @@ func (p *MTR) Stop() {
 func (p *MTR) AddTargets() {
 	p.logger.Debug("Current Targets", "type", "MTR", "func", "AddTargets", "count", len(p.targets), "configured", countTargets(p.sc, "MTR"))
 
+	// The targets whose settings changed are added again (restarted)
+	changed := p.update()
+
 	targetActiveTmp := []string{}
 	for _, v := range p.targets {
+		if changedTarget(changed, nil, v.Name()) {
+			continue
+		}
 		targetActiveTmp = common.AppendIfMissing(targetActiveTmp, v.Name())
 	}
 
@@ -104,6 +118,33 @@ func (p *MTR) AddTargets() {
 	}
 }
 
+// update applies the global MTR settings of the configuration and returns the targets whose settings changed
+func (p *MTR) update() map[string]bool {
+	p.sc.RLock()
+	cfg := p.sc.Cfg
+	p.sc.RUnlock()
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.interval = cfg.MTR.Interval.Duration()
+	p.timeout = cfg.MTR.Timeout.Duration()
+	p.maxHops = cfg.MTR.MaxHops
+	p.count = cfg.MTR.Count
+	p.payloadSize = cfg.MTR.PayloadSize
+	p.protocol = cfg.MTR.Protocol
+	p.tcpPort = cfg.MTR.TcpPort
+	p.udpPort = cfg.MTR.UdpPort
+	p.udpParis = cfg.MTR.UdpParis
+	p.parallel = cfg.MTR.Parallel
+
+	changed := diffSpecs(p.specs, cfg.Targets, func(t config.Target) bool { return t.Type == "MTR" || t.Type == "ICMP+MTR" }, cfg.MTR)
+	for name := range changed {
+		p.logger.Info("Restarting Target, settings changed", "type", "MTR", "func", "update", "name", name)
+	}
+	return changed
+}
+
 // AddTarget adds a target to the monitored list
 func (p *MTR) AddTarget(name string, host string, srcAddr string, labels map[string]string) (err error) {
 	return p.AddTargetDelayed(name, host, srcAddr, labels, 0)
@@ -116,10 +157,13 @@ func (p *MTR) AddTargetDelayed(name string, host string, srcAddr string, labels
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
 
-	// Parse port from host if specified (for TCP protocol)
+	// Parse port from host if specified (for TCP and UDP protocol)
 	targetHost := host
 	targetPort := p.tcpPort // Use default port from config
-	if p.protocol == "tcp" && strings.Contains(host, ":") {
+	if p.protocol == "udp" {
+		targetPort = p.udpPort
+	}
+	if (p.protocol == "tcp" || p.protocol == "udp") && strings.Contains(host, ":") {
 		// Extract port from host string (e.g., "example.com:443")
 		parts := strings.Split(host, ":")
 		if len(parts) == 2 {
@@ -134,11 +178,15 @@ func (p *MTR) AddTargetDelayed(name string, host string, srcAddr string, labels
 		return err
 	}
 
-	target, err := target.NewMTR(p.logger, p.icmpID, startupDelay, name, ipAddrs[0], srcAddr, p.interval, p.timeout, p.maxHops, p.count, p.payloadSize, p.protocol, targetPort, labels, p.ipv6, p.maxConcurrentJobs)
+	target, err := target.NewMTR(p.logger, p.icmpID, startupDelay, name, ipAddrs[0], srcAddr, p.interval, p.timeout, p.maxHops, p.count, p.payloadSize, p.protocol, targetPort, p.udpParis, p.parallel, labels, p.ipv6, p.maxConcurrentJobs)
 	if err != nil {
 		return err
 	}
-	p.removeTarget(name)
+	// Keep the cumulative counters of the target that is replaced
+	if old, found := p.targets[name]; found {
+		p.removeTarget(name)
+		target.Inherit(old)
+	}
 	p.targets[name] = target
 	return nil
 }
@@ -261,3 +309,28 @@ func (p *MTR) ExportLabels() map[string]map[string]string {
 	}
 	return l
 }
+
+// ExportResult returns the latest MTR results of a target
+func (p *MTR) ExportResult(name string) (*mtr.MtrResult, bool) {
+	p.mtx.RLock()
+	target, found := p.targets[name]
+	p.mtx.RUnlock()
+
+	if !found {
+		return nil, false
+	}
+	return target.Compute(), true
+}
+
+// RunTarget executes a new MTR of a target on demand, the result is not added to the target metrics
+func (p *MTR) RunTarget(ctx context.Context, name string) (*mtr.MtrResult, bool, error) {
+	p.mtx.RLock()
+	target, found := p.targets[name]
+	p.mtx.RUnlock()
+
+	if !found {
+		return nil, false, nil
+	}
+	result, err := target.Run(ctx)
+	return result, true, err
+}
@@ -5,7 +5,6 @@ import (
 	"log/slog"
 	"math/rand"
 	"os"
-	"strings"
 	"sync"
 	"time"
 
@@ -28,6 +27,8 @@ type PING struct {
 	ipv6              bool
 	maxConcurrentJobs int
 	targets           map[string]*target.PING
+	parents           map[string]string
+	specs             map[string]string
 	mtx               sync.RWMutex
 }
 
@@ -48,6 +49,8 @@ func NewPing(logger *slog.Logger, sc *config.SafeConfig, resolver *config.Resolv
 		ipv6:              ipv6,
 		maxConcurrentJobs: maxConcurrentJobs,
 		targets:           make(map[string]*target.PING),
+		parents:           make(map[string]string),
+		specs:             make(map[string]string),
 	}
 }
 
@@ -65,8 +68,14 @@ func (p *PING) Stop() {
 func (p *PING) AddTargets() {
 	p.logger.Debug("Current Targets", "type", "ICMP", "func", "AddTargets", "count", len(p.targets), "configured", countTargets(p.sc, "ICMP"))
 
+	// The targets whose settings changed are added again (restarted)
+	changed := p.update()
+
 	targetActiveTmp := []string{}
 	for _, v := range p.targets {
+		if changedTarget(changed, p.parents, v.Name()) {
+			continue
+		}
 		targetActiveTmp = common.AppendIfMissing(targetActiveTmp, v.Name())
 	}
 
@@ -100,7 +109,7 @@ func (p *PING) AddTargets() {
 					}
 					// Add jitter to prevent thundering herd (0-10% of interval)
 					jitter := time.Duration(rand.Int63n(int64(p.interval / 10)))
-					err := p.AddTargetDelayed(target.Name+" "+ipAddr, target.Host, ipAddr, target.SourceIp, target.Labels.Kv, jitter)
+					err := p.addSubTarget(target.Name+" "+ipAddr, ipAddr, target, jitter)
 					if err != nil {
 						p.logger.Warn("Skipping target", "type", "ICMP", "func", "AddTargets", "host", target.Host, "ip", ipAddr, "err", err)
 					}
@@ -110,6 +119,27 @@ func (p *PING) AddTargets() {
 	}
 }
 
+// update applies the global ICMP settings of the configuration and returns the targets whose settings changed
+func (p *PING) update() map[string]bool {
+	p.sc.RLock()
+	cfg := p.sc.Cfg
+	p.sc.RUnlock()
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.interval = cfg.ICMP.Interval.Duration()
+	p.timeout = cfg.ICMP.Timeout.Duration()
+	p.count = cfg.ICMP.Count
+	p.payloadSize = cfg.ICMP.PayloadSize
+
+	changed := diffSpecs(p.specs, cfg.Targets, func(t config.Target) bool { return t.Type == "ICMP" || t.Type == "ICMP+MTR" }, cfg.ICMP)
+	for name := range changed {
+		p.logger.Info("Restarting Target, settings changed", "type", "ICMP", "func", "update", "name", name)
+	}
+	return changed
+}
+
 // AddTarget adds a target to the monitored list
 func (p *PING) AddTarget(name string, host string, ip string, srcAddr string, labels map[string]string) (err error) {
 	return p.AddTargetDelayed(name, host, ip, srcAddr, labels, 0)
@@ -126,11 +156,26 @@ func (p *PING) AddTargetDelayed(name string, host string, ip string, srcAddr str
 	if err != nil {
 		return err
 	}
-	p.removeTarget(name)
+	// Keep the cumulative counters of the target that is replaced
+	if old, found := p.targets[name]; found {
+		p.removeTarget(name)
+		target.Inherit(old)
+	}
 	p.targets[name] = target
 	return nil
 }
 
+// addSubTarget adds a target of the configured target t for one of its ips and records its parent target
+func (p *PING) addSubTarget(name string, ip string, t config.Target, startupDelay time.Duration) error {
+	if err := p.AddTargetDelayed(name, t.Host, ip, t.SourceIp, t.Labels.Kv, startupDelay); err != nil {
+		return err
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.parents[name] = t.Name
+	return nil
+}
+
 // DelTargets deletes/stops the removed targets from the configuration
 func (p *PING) DelTargets() {
 	p.logger.Debug("Current Targets", "type", "ICMP", "func", "DelTargets", "count", len(p.targets), "configured", countTargets(p.sc, "ICMP"))
@@ -184,23 +229,31 @@ func (p *PING) removeTarget(key string) {
 	}
 	target.Stop()
 	delete(p.targets, key)
+	delete(p.parents, key)
 }
 
 // Read target if IP was changed (DNS record)
 func (p *PING) CheckActiveTargets() (err error) {
 	p.logger.Debug("Current Targets", "type", "ICMP", "func", "CheckActiveTargets", "count", len(p.targets), "configured", countTargets(p.sc, "ICMP"))
 
-	targetActiveTmp := make(map[string]string)
+	// Running targets and their parent target
+	type activeTarget struct {
+		parent string
+		ip     string
+	}
+	targetActiveTmp := make(map[string]activeTarget)
+	p.mtx.RLock()
 	for _, v := range p.targets {
-		targetActiveTmp[v.Name()+" "+v.Ip()] = v.Ip()
+		targetActiveTmp[v.Name()] = activeTarget{parent: p.parents[v.Name()], ip: v.Ip()}
 	}
+	p.mtx.RUnlock()
 
-	for targetName, targetIp := range targetActiveTmp {
+	for targetName, active := range targetActiveTmp {
 		for _, target := range p.sc.Cfg.Targets {
 			if target.Type != "ICMP" && target.Type != "ICMP+MTR" {
 				continue
 			}
-			if !strings.HasPrefix(targetName, target.Name+" ") {
+			if active.parent != target.Name {
 				continue
 			}
 			ipAddrs, err := common.DestAddrs(context.Background(), target.Host, p.resolver.Resolver, p.resolver.Timeout, p.ipv6)
@@ -208,13 +261,13 @@ func (p *PING) CheckActiveTargets() (err error) {
 				return err
 			}
 
-			if !common.ContainsString(ipAddrs, targetIp) {
+			if !common.ContainsString(ipAddrs, active.ip) {
 				p.RemoveTarget(targetName)
 
 				for _, ipAddr := range ipAddrs {
 					// Add jitter to prevent thundering herd (0-10% of interval)
 					jitter := time.Duration(rand.Int63n(int64(p.interval / 10)))
-					err := p.AddTargetDelayed(target.Name+" "+ipAddr, target.Host, ipAddr, target.SourceIp, target.Labels.Kv, jitter)
+					err := p.addSubTarget(target.Name+" "+ipAddr, ipAddr, target, jitter)
 					if err != nil {
 						p.logger.Warn("Skipping target", "type", "ICMP", "func", "CheckActiveTargets", "host", target.Host, "ip", ipAddr, "err", err)
 					}
@@ -4,8 +4,9 @@ import (
 	"context"
 	"log/slog"
 	"math/rand"
+	"net"
 	"os"
-	"strings"
+	"regexp"
 	"sync"
 	"time"
 
@@ -22,9 +23,12 @@ type TCPPort struct {
 	resolver          *config.Resolver
 	interval          time.Duration
 	timeout           time.Duration
+	count             int
 	ipv6              bool
 	maxConcurrentJobs int
 	targets           map[string]*target.TCPPort
+	parents           map[string]string
+	specs             map[string]string
 	mtx               sync.RWMutex
 }
 
@@ -39,9 +43,12 @@ func NewTCPPort(logger *slog.Logger, sc *config.SafeConfig, resolver *config.Res
 		resolver:          resolver,
 		interval:          sc.Cfg.TCP.Interval.Duration(),
 		timeout:           sc.Cfg.TCP.Timeout.Duration(),
+		count:             sc.Cfg.TCP.Count,
 		ipv6:              ipv6,
 		maxConcurrentJobs: maxConcurrentJobs,
 		targets:           make(map[string]*target.TCPPort),
+		parents:           make(map[string]string),
+		specs:             make(map[string]string),
 	}
 }
 
@@ -59,25 +66,22 @@ func (p *TCPPort) Stop() {
 func (p *TCPPort) AddTargets() {
 	p.logger.Debug("Current Targets", "type", "TCP", "func", "AddTargets", "count", len(p.targets), "configured", countTargets(p.sc, "TCP"))
 
+	// The targets whose settings changed are added again (restarted)
+	changed := p.update()
+
 	targetActiveTmp := []string{}
 	for _, v := range p.targets {
+		if changedTarget(changed, p.parents, v.Name()) {
+			continue
+		}
 		targetActiveTmp = common.AppendIfMissing(targetActiveTmp, v.Name())
 	}
 
 	targetConfigTmp := []string{}
 	for _, v := range p.sc.Cfg.Targets {
 		if v.Type == "TCP" {
-			conn := strings.Split(v.Host, ":")
-			if len(conn) != 2 {
-				p.logger.Warn("Skipping target, could not identify host", "type", "TCP", "func", "AddTargets", "host", v.Host, "name", v.Name)
-				continue
-			}
-			ipAddrs, err := common.DestAddrs(context.Background(), conn[0], p.resolver.Resolver, p.resolver.Timeout, p.ipv6)
-			if err != nil || len(ipAddrs) == 0 {
-				p.logger.Warn("Skipping resolve target", "type", "TCP", "func", "AddTargets", "host", v.Host, "err", err)
-			}
-			for _, ipAddr := range ipAddrs {
-				targetConfigTmp = common.AppendIfMissing(targetConfigTmp, v.Name+" "+ipAddr)
+			for targetName := range p.subTargets(v, "AddTargets") {
+				targetConfigTmp = common.AppendIfMissing(targetConfigTmp, targetName)
 			}
 		}
 	}
@@ -96,49 +100,101 @@ func (p *TCPPort) AddTargets() {
 			continue
 		}
 
-		// Parse host:port once
-		conn := strings.Split(target.Host, ":")
-		if len(conn) != 2 {
-			p.logger.Warn("Skipping target, could not identify host", "type", "TCP", "func", "AddTargets", "host", target.Host, "name", target.Name)
-			continue
-		}
-
-		// Resolve DNS once per target
-		ipAddrs, err := common.DestAddrs(context.Background(), conn[0], p.resolver.Resolver, p.resolver.Timeout, p.ipv6)
-		if err != nil || len(ipAddrs) == 0 {
-			p.logger.Warn("Skipping resolve target", "type", "TCP", "func", "AddTargets", "name", target.Name, "err", err)
-			continue
-		}
-
-		// Add all IPs for this target
-		for _, ipAddr := range ipAddrs {
-			targetName := target.Name + " " + ipAddr
+		// Add all IPs and ports for this target
+		for targetName, sub := range p.subTargets(target, "AddTargets") {
 			if !targetLookup[targetName] {
 				continue
 			}
 			// Add jitter to prevent thundering herd (0-10% of interval)
 			jitter := time.Duration(rand.Int63n(int64(p.interval / 10)))
-			err := p.AddTargetDelayed(targetName, conn[0], ipAddr, target.SourceIp, conn[1], target.Labels.Kv, jitter)
+			err := p.addSubTarget(targetName, sub, target, jitter)
 			if err != nil {
-				p.logger.Warn("Skipping target", "type", "TCP", "func", "AddTargets", "host", target.Host, "ip", ipAddr, "err", err)
+				p.logger.Warn("Skipping target", "type", "TCP", "func", "AddTargets", "host", target.Host, "ip", sub.ip, "port", sub.port, "err", err)
+			}
+		}
+	}
+}
+
+// tcpSubTarget TCP target for a single resolved ip and port
+type tcpSubTarget struct {
+	host string
+	ip   string
+	port string
+}
+
+// subTargets expands a configured target (host:ports) to its resolved ips and ports
+// The target names are "name ip", or "name ip port" if the host contains a port list or range (22,80,8000-8010)
+func (p *TCPPort) subTargets(t config.Target, fn string) map[string]tcpSubTarget {
+	host, portList, err := net.SplitHostPort(t.Host)
+	if err != nil {
+		p.logger.Warn("Skipping target, could not identify host", "type", "TCP", "func", fn, "host", t.Host, "name", t.Name, "err", err)
+		return nil
+	}
+
+	ports, err := common.ExpandPorts(portList)
+	if err != nil {
+		p.logger.Warn("Skipping target, could not identify ports", "type", "TCP", "func", fn, "host", t.Host, "name", t.Name, "err", err)
+		return nil
+	}
+
+	// Resolve DNS once per target
+	ipAddrs, err := common.DestAddrs(context.Background(), host, p.resolver.Resolver, p.resolver.Timeout, p.ipv6)
+	if err != nil || len(ipAddrs) == 0 {
+		p.logger.Warn("Skipping resolve target", "type", "TCP", "func", fn, "host", t.Host, "err", err)
+		return nil
+	}
+
+	targets := make(map[string]tcpSubTarget, len(ipAddrs)*len(ports))
+	for _, ipAddr := range ipAddrs {
+		for _, port := range ports {
+			targetName := t.Name + " " + ipAddr
+			if len(ports) > 1 {
+				targetName += " " + port
 			}
+			targets[targetName] = tcpSubTarget{host: host, ip: ipAddr, port: port}
 		}
 	}
+	return targets
+}
+
+// update applies the global TCP settings of the configuration and returns the targets whose settings changed
+func (p *TCPPort) update() map[string]bool {
+	p.sc.RLock()
+	cfg := p.sc.Cfg
+	p.sc.RUnlock()
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.interval = cfg.TCP.Interval.Duration()
+	p.timeout = cfg.TCP.Timeout.Duration()
+	p.count = cfg.TCP.Count
+
+	changed := diffSpecs(p.specs, cfg.Targets, func(t config.Target) bool { return t.Type == "TCP" }, cfg.TCP)
+	for name := range changed {
+		p.logger.Info("Restarting Target, settings changed", "type", "TCP", "func", "update", "name", name)
+	}
+	return changed
 }
 
 // AddTarget adds a target to the monitored list
-func (p *TCPPort) AddTarget(name string, host string, ip string, srcAddr string, port string, labels map[string]string) (err error) {
-	return p.AddTargetDelayed(name, host, ip, srcAddr, port, labels, 0)
+func (p *TCPPort) AddTarget(name string, host string, ip string, srcAddr string, port string, expect string, queryResponse []config.QueryResponse, labels map[string]string) (err error) {
+	return p.AddTargetDelayed(name, host, ip, srcAddr, port, expect, queryResponse, labels, 0)
 }
 
 // AddTargetDelayed is AddTarget with a startup delay
-func (p *TCPPort) AddTargetDelayed(name string, host string, ip string, srcAddr string, port string, labels map[string]string, startupDelay time.Duration) (err error) {
-	p.logger.Info("Adding Target", "type", "TCP", "func", "AddTargetDelayed", "name", name, "host", host, "ip", ip, "port", port, "delay", startupDelay)
+func (p *TCPPort) AddTargetDelayed(name string, host string, ip string, srcAddr string, port string, expect string, queryResponse []config.QueryResponse, labels map[string]string, startupDelay time.Duration) (err error) {
+	p.logger.Info("Adding Target", "type", "TCP", "func", "AddTargetDelayed", "name", name, "host", host, "ip", ip, "port", port, "expect", expect, "query_steps", len(queryResponse), "delay", startupDelay)
 
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
 
-	target, err := target.NewTCPPort(p.logger, startupDelay, name, host, ip, srcAddr, port, p.interval, p.timeout, labels, p.maxConcurrentJobs)
+	steps, err := tcpQueryResponse(queryResponse)
+	if err != nil {
+		return err
+	}
+
+	target, err := target.NewTCPPort(p.logger, startupDelay, name, host, ip, srcAddr, port, expect, steps, p.interval, p.timeout, p.count, labels, p.maxConcurrentJobs)
 	if err != nil {
 		return err
 	}
@@ -147,6 +203,34 @@ func (p *TCPPort) AddTargetDelayed(name string, host string, ip string, srcAddr
 	return nil
 }
 
+// addSubTarget adds a sub target of the configured target t and records its parent target
+func (p *TCPPort) addSubTarget(name string, sub tcpSubTarget, t config.Target, startupDelay time.Duration) error {
+	if err := p.AddTargetDelayed(name, sub.host, sub.ip, t.SourceIp, sub.port, t.Expect, t.QueryResponse, t.Labels.Kv, startupDelay); err != nil {
+		return err
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.parents[name] = t.Name
+	return nil
+}
+
+// tcpQueryResponse maps the configured query_response steps to the TCP dialogue steps
+func tcpQueryResponse(queryResponse []config.QueryResponse) ([]tcp.QueryResponse, error) {
+	steps := make([]tcp.QueryResponse, 0, len(queryResponse))
+	for _, qr := range queryResponse {
+		step := tcp.QueryResponse{Send: qr.Send, StartTLS: qr.StartTLS}
+		if qr.Expect != "" {
+			re, err := regexp.Compile(qr.Expect)
+			if err != nil {
+				return nil, err
+			}
+			step.Expect = re
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
 // DelTargets deletes/stops the removed targets from the configuration
 func (p *TCPPort) DelTargets() {
 	p.logger.Debug("Current Targets", "type", "TCP", "func", "DelTargets", "count", len(p.targets), "configured", countTargets(p.sc, "TCP"))
@@ -161,17 +245,8 @@ func (p *TCPPort) DelTargets() {
 	targetConfigTmp := []string{}
 	for _, v := range p.sc.Cfg.Targets {
 		if v.Type == "TCP" {
-			conn := strings.Split(v.Host, ":")
-			if len(conn) != 2 {
-				p.logger.Warn("Skipping target, could not identify host", "type", "TCP", "func", "DelTargets", "host", v.Host, "name", v.Name)
-				continue
-			}
-			ipAddrs, err := common.DestAddrs(context.Background(), conn[0], p.resolver.Resolver, p.resolver.Timeout, p.ipv6)
-			if err != nil || len(ipAddrs) == 0 {
-				p.logger.Warn("Skipping resolve target", "type", "TCP", "func", "DelTargets", "host", v.Host, "err", err)
-			}
-			for _, ipAddr := range ipAddrs {
-				targetConfigTmp = common.AppendIfMissing(targetConfigTmp, v.Name+" "+ipAddr)
+			for targetName := range p.subTargets(v, "DelTargets") {
+				targetConfigTmp = common.AppendIfMissing(targetConfigTmp, targetName)
 			}
 		}
 	}
@@ -205,43 +280,54 @@ func (p *TCPPort) removeTarget(key string) {
 	}
 	target.Stop()
 	delete(p.targets, key)
+	delete(p.parents, key)
 }
 
 // Read target if IP was changed (DNS record)
 func (p *TCPPort) CheckActiveTargets() (err error) {
 	p.logger.Debug("Current Targets", "type", "TCP", "func", "CheckActiveTargets", "count", len(p.targets), "configured", countTargets(p.sc, "TCP"))
 
+	// Running sub targets and their parent target
 	targetActiveTmp := make(map[string]string)
+	p.mtx.RLock()
 	for _, v := range p.targets {
-		targetActiveTmp[v.Name()+" "+v.Ip()] = v.Ip()
+		targetActiveTmp[v.Name()] = p.parents[v.Name()]
 	}
+	p.mtx.RUnlock()
+
+	for _, target := range p.sc.Cfg.Targets {
+		if target.Type != "TCP" {
+			continue
+		}
+		subTargets := p.subTargets(target, "CheckActiveTargets")
+		if len(subTargets) == 0 {
+			continue
+		}
 
-	for targetName, targetIp := range targetActiveTmp {
-		for _, target := range p.sc.Cfg.Targets {
-			if target.Name != targetName {
+		// Replace the sub targets of the ips that are no longer resolved
+		changed := false
+		for targetName, parent := range targetActiveTmp {
+			if parent != target.Name {
 				continue
 			}
-			ipAddrs, err := common.DestAddrs(context.Background(), strings.Split(target.Host, ":")[0], p.resolver.Resolver, p.resolver.Timeout, p.ipv6)
-			if err != nil || len(ipAddrs) == 0 {
-				return err
+			if _, found := subTargets[targetName]; !found {
+				p.RemoveTarget(targetName)
+				changed = true
 			}
+		}
+		if !changed {
+			continue
+		}
 
-			if !common.ContainsString(ipAddrs, targetIp) {
-				p.RemoveTarget(targetName + " " + targetIp)
-
-				conn := strings.Split(target.Host, ":")
-				if len(conn) != 2 {
-					p.logger.Warn("Skipping target, could not identify host", "type", "TCP", "func", "CheckActiveTargets", "host", target.Host, "name", target.Name)
-					continue
-				}
-				for _, ipAddr := range ipAddrs {
-					// Add jitter to prevent thundering herd (0-10% of interval)
-					jitter := time.Duration(rand.Int63n(int64(p.interval / 10)))
-					err := p.AddTargetDelayed(target.Name+" "+ipAddr, conn[0], ipAddr, target.SourceIp, conn[1], target.Labels.Kv, jitter)
-					if err != nil {
-						p.logger.Warn("Skipping target", "type", "TCP", "func", "CheckActiveTargets", "host", target.Host, "err", err)
-					}
-				}
+		for targetName, sub := range subTargets {
+			if _, found := targetActiveTmp[targetName]; found {
+				continue
+			}
+			// Add jitter to prevent thundering herd (0-10% of interval)
+			jitter := time.Duration(rand.Int63n(int64(p.interval / 10)))
+			err := p.addSubTarget(targetName, sub, target, jitter)
+			if err != nil {
+				p.logger.Warn("Skipping target", "type", "TCP", "func", "CheckActiveTargets", "host", target.Host, "err", err)
 			}
 		}
 	}
@@ -0,0 +1,338 @@
+package cluster
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/syepes/network_exporter/pkg/common"
+)
+
+// InstanceHeader Response header of the health endpoint with the instance ID, the peers are identified by it instead of their address
+const InstanceHeader = "X-Network-Exporter-Instance"
+
+// Settings Peer discovery and liveness check of the cluster
+type Settings struct {
+	Peers        []string
+	PeersDNS     []string
+	Scheme       string
+	Interval     time.Duration
+	Timeout      time.Duration
+	Username     string
+	Password     string
+	PasswordFile string
+	TLS          TLSSettings
+}
+
+// TLSSettings TLS client settings of the peers health check
+type TLSSettings struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// Enabled checks if any peer source is configured
+func (s Settings) Enabled() bool {
+	return len(s.Peers) > 0 || len(s.PeersDNS) > 0
+}
+
+// Peer Status of a peer address and the instance that answered on it
+type Peer struct {
+	ID string
+	Up bool
+}
+
+// Cluster tracks the live exporter instances (peers) that share the targets
+// The peers are checked over their HTTP port (/-/healthy) and identified by the instance ID they return, this instance (self) is always a member
+type Cluster struct {
+	logger   *slog.Logger
+	self     string
+	client   *http.Client
+	settings Settings
+	peers    map[string]Peer
+	listed   bool
+	dns      map[string][]string
+	changes  chan struct{}
+	update   chan struct{}
+	mtx      sync.RWMutex
+}
+
+// New starts the tracking of the cluster peers, self is the ID of this instance that must be unique in the cluster
+func New(logger *slog.Logger, self string) *Cluster {
+	c := &Cluster{
+		logger:  logger,
+		self:    self,
+		client:  &http.Client{},
+		peers:   map[string]Peer{},
+		listed:  true,
+		dns:     map[string][]string{},
+		changes: make(chan struct{}, 1),
+		update:  make(chan struct{}, 1),
+	}
+	go c.run()
+	return c
+}
+
+// NewClient returns the HTTP client of the peers health check
+func NewClient(s Settings) (*http.Client, error) {
+	tlsConfig := &tls.Config{ServerName: s.TLS.ServerName, InsecureSkipVerify: s.TLS.InsecureSkipVerify}
+	if s.TLS.CAFile != "" {
+		ca, err := os.ReadFile(s.TLS.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading ca_file: %s", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("ca_file: no certificates found in %s", s.TLS.CAFile)
+		}
+	}
+	if s.TLS.CertFile != "" || s.TLS.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.TLS.CertFile, s.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading cert_file/key_file: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}, nil
+}
+
+// Self returns the ID of this instance
+func (c *Cluster) Self() string {
+	return c.self
+}
+
+// Changes returns a channel that receives a notification when the members change
+func (c *Cluster) Changes() <-chan struct{} {
+	return c.changes
+}
+
+// Set replaces the cluster settings, the peers are checked at once if they changed
+func (c *Cluster) Set(s Settings) {
+	c.mtx.Lock()
+	if reflect.DeepEqual(c.settings, s) {
+		c.mtx.Unlock()
+		return
+	}
+	c.settings = s
+	client, err := NewClient(s)
+	if err != nil {
+		c.logger.Error("Cluster health check client", "type", "Cluster", "func", "Set", "err", err)
+		client = &http.Client{}
+	}
+	c.client = client
+	c.mtx.Unlock()
+
+	select {
+	case c.update <- struct{}{}:
+	default:
+	}
+}
+
+// Members returns the sorted IDs of the live instances
+func (c *Cluster) Members() []string {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.members()
+}
+
+// Peers returns the status of every peer address
+func (c *Cluster) Peers() map[string]Peer {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	peers := map[string]Peer{}
+	if !c.settings.Enabled() {
+		return peers
+	}
+	for addr, p := range c.peers {
+		peers[addr] = p
+	}
+	return peers
+}
+
+// members returns the live instances (the caller holds the lock)
+func (c *Cluster) members() []string {
+	members := []string{c.self}
+	for _, p := range c.peers {
+		if p.Up {
+			members = common.AppendIfMissing(members, p.ID)
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+// run checks the peers every interval and when the settings change
+func (c *Cluster) run() {
+	for {
+		c.mtx.RLock()
+		s := c.settings
+		client := c.client
+		c.mtx.RUnlock()
+
+		c.check(s, client)
+
+		if !s.Enabled() || s.Interval <= 0 {
+			<-c.update
+			continue
+		}
+		timer := time.NewTimer(s.Interval)
+		select {
+		case <-c.update:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// check discovers the peers and checks their liveness, a change of the members is notified
+func (c *Cluster) check(s Settings, client *http.Client) {
+	peers := map[string]Peer{}
+	if s.Enabled() {
+		var mtx sync.Mutex
+		var wg sync.WaitGroup
+		for _, p := range c.discover(s) {
+			wg.Add(1)
+			go func(addr string) {
+				defer wg.Done()
+				id, up := c.healthy(s, client, addr)
+				mtx.Lock()
+				peers[addr] = Peer{ID: id, Up: up}
+				mtx.Unlock()
+			}(p)
+		}
+		wg.Wait()
+	}
+
+	// The other instances only know this instance if one of the peer addresses reaches it
+	listed := !s.Enabled()
+	for _, p := range peers {
+		if p.Up && p.ID == c.self {
+			listed = true
+		}
+	}
+
+	c.mtx.Lock()
+	before := c.members()
+	c.peers = peers
+	after := c.members()
+	wasListed := c.listed
+	c.listed = listed
+	c.mtx.Unlock()
+
+	if !listed && wasListed {
+		c.logger.Warn("This instance is not reachable on any cluster peer address, the other instances don't run its targets", "type", "Cluster", "func", "check", "instance", c.self)
+	}
+	if reflect.DeepEqual(before, after) {
+		return
+	}
+	c.logger.Info("Cluster members changed", "type", "Cluster", "func", "check", "members", strings.Join(after, ","))
+	select {
+	case c.changes <- struct{}{}:
+	default:
+	}
+}
+
+// discover returns the static peers and the peers resolved from DNS (SRV or A/AAAA records)
+// The last resolved peers of a DNS name are kept when the lookup fails
+func (c *Cluster) discover(s Settings) []string {
+	peers := []string{}
+	for _, p := range s.Peers {
+		peers = common.AppendIfMissing(peers, p)
+	}
+
+	for _, name := range s.PeersDNS {
+		resolved, err := resolve(name, s.Timeout)
+		if err != nil {
+			c.logger.Warn("Resolving cluster peers", "type", "Cluster", "func", "discover", "name", name, "err", err)
+			resolved = c.dns[name]
+		} else {
+			c.dns[name] = resolved
+		}
+		for _, p := range resolved {
+			peers = common.AppendIfMissing(peers, p)
+		}
+	}
+	return peers
+}
+
+// resolve returns the peer addresses of a SRV record (_service._proto.name) or of a name:port A/AAAA record
+func resolve(name string, timeout time.Duration) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	peers := []string{}
+	if common.SrvRecordCheck(name) {
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			peers = append(peers, net.JoinHostPort(strings.TrimSuffix(r.Target, "."), fmt.Sprint(r.Port)))
+		}
+		return peers, nil
+	}
+
+	host, port, err := net.SplitHostPort(name)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		peers = append(peers, net.JoinHostPort(ip, port))
+	}
+	return peers, nil
+}
+
+// healthy checks a peer with its health endpoint and returns the ID of the instance that answered
+// A peer that doesn't return its instance ID is considered down
+func (c *Cluster) healthy(s Settings, client *http.Client, peer string) (string, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.Scheme+"://"+peer+"/-/healthy", nil)
+	if err != nil {
+		return "", false
+	}
+	if s.Username != "" {
+		password := s.Password
+		if s.PasswordFile != "" {
+			b, err := os.ReadFile(s.PasswordFile)
+			if err != nil {
+				c.logger.Error("Reading cluster password_file", "type", "Cluster", "func", "healthy", "err", err)
+				return "", false
+			}
+			password = strings.TrimSpace(string(b))
+		}
+		req.SetBasicAuth(s.Username, password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		c.logger.Debug("Cluster peer down", "type", "Cluster", "func", "healthy", "peer", peer, "err", err)
+		return "", false
+	}
+	defer resp.Body.Close()
+
+	id := resp.Header.Get(InstanceHeader)
+	if resp.StatusCode != http.StatusOK || id == "" {
+		c.logger.Debug("Cluster peer down", "type", "Cluster", "func", "healthy", "peer", peer, "status", resp.Status, "instance", id)
+		return id, false
+	}
+	return id, true
+}
@@ -3,8 +3,12 @@ package common
 import (
 	"context"
 	"fmt"
+	"hash/fnv"
 	"math"
 	"net"
+	"net/netip"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -46,6 +50,99 @@ func SrvRecordHosts(record string) ([]string, error) {
 	return hosts, nil
 }
 
+// HostRangeCheck checks if the host is a CIDR (10.0.0.0/28) or an IP range (10.0.0.1-10.0.0.20)
+func HostRangeCheck(host string) bool {
+	if _, err := netip.ParsePrefix(host); err == nil {
+		return true
+	}
+	from, to, found := strings.Cut(host, "-")
+	if !found {
+		return false
+	}
+	_, err1 := netip.ParseAddr(from)
+	_, err2 := netip.ParseAddr(to)
+	return err1 == nil && err2 == nil
+}
+
+// HostRangeAddrs expands a CIDR or an IP range to its IPs, the network and broadcast addresses of the IPv4 CIDRs are excluded
+// The expansion fails if it exceeds max IPs
+func HostRangeAddrs(host string, max int) ([]string, error) {
+	var from, to netip.Addr
+	if prefix, err := netip.ParsePrefix(host); err == nil {
+		prefix = prefix.Masked()
+		hostBits := prefix.Addr().BitLen() - prefix.Bits()
+		size := 1 << min(hostBits, 62)
+		if prefix.Addr().Is4() && hostBits > 1 {
+			size -= 2
+		}
+		if size > max {
+			return nil, fmt.Errorf("range %s exceeds the maximum of %d hosts", host, max)
+		}
+
+		from = prefix.Addr()
+		to = from
+		for next := to.Next(); next.IsValid() && prefix.Contains(next); next = next.Next() {
+			to = next
+		}
+		if from.Is4() && hostBits > 1 {
+			from = from.Next()
+			to = to.Prev()
+		}
+	} else {
+		f, t, found := strings.Cut(host, "-")
+		if !found {
+			return nil, fmt.Errorf("invalid range: %s", host)
+		}
+		if from, err = netip.ParseAddr(f); err != nil {
+			return nil, fmt.Errorf("invalid range: %s", host)
+		}
+		if to, err = netip.ParseAddr(t); err != nil {
+			return nil, fmt.Errorf("invalid range: %s", host)
+		}
+		if from.Is4() != to.Is4() || from.Compare(to) > 0 {
+			return nil, fmt.Errorf("invalid range: %s", host)
+		}
+	}
+
+	addrs := []string{}
+	for ip := from; ip.IsValid() && ip.Compare(to) <= 0; ip = ip.Next() {
+		if len(addrs) == max {
+			return nil, fmt.Errorf("range %s exceeds the maximum of %d hosts", host, max)
+		}
+		addrs = append(addrs, ip.String())
+	}
+	return addrs, nil
+}
+
+// Rendezvous returns the n nodes with the highest rendezvous hash (HRW) for the key
+// Every node picks the same nodes for a key, and adding or removing a node only moves the keys of that node
+func Rendezvous(key string, nodes []string, n int) []string {
+	type score struct {
+		node  string
+		score uint64
+	}
+	scores := make([]score, 0, len(nodes))
+	for _, node := range nodes {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(node))
+		scores = append(scores, score{node: node, score: h.Sum64()})
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].score == scores[j].score {
+			return scores[i].node < scores[j].node
+		}
+		return scores[i].score > scores[j].score
+	})
+
+	selected := []string{}
+	for i := 0; i < n && i < len(scores); i++ {
+		selected = append(selected, scores[i].node)
+	}
+	return selected
+}
+
 // DestAddrs resolve the hostname to all it'ss IP's
 func DestAddrs(ctx context.Context, host string, resolver *net.Resolver, timeout time.Duration, enableIPv6 bool) ([]string, error) {
 	ipAddrs := make([]string, 0)
@@ -159,6 +256,34 @@ func TimeCorrectedDeviation(values []time.Duration) float64 {
 	return math.Sqrt(sd / (float64(len(values)) - 1))
 }
 
+// ExpandPorts expands a port list with ranges (22,80,8000-8010) to the individual ports
+func ExpandPorts(spec string) ([]string, error) {
+	ports := []string{}
+	seen := make(map[int]bool)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		from, to, isRange := strings.Cut(item, "-")
+		start, err := strconv.Atoi(from)
+		if err != nil || start < 1 || start > 65535 {
+			return nil, fmt.Errorf("invalid port: %v", item)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(to)
+			if err != nil || end < start || end > 65535 {
+				return nil, fmt.Errorf("invalid port range: %v", item)
+			}
+		}
+		for port := start; port <= end; port++ {
+			if !seen[port] {
+				seen[port] = true
+				ports = append(ports, strconv.Itoa(port))
+			}
+		}
+	}
+	return ports, nil
+}
+
 // CompareList Compare two lists and return a list with the difference
 // Returns elements in b that are not in a
 func CompareList(a, b []string) []string {
@@ -74,4 +74,5 @@ type IcmpHop struct {
 	CorrectedSDTime      time.Duration `json:"csd"`
 	RangeTime            time.Duration `json:"range"`
 	Loss                 float64       `json:"loss"`
+	ForwardLoss          float64       `json:"forward_loss"`
 }
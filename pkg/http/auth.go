@@ -0,0 +1,126 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// HTTPAuth HTTP Authentication settings
+// Secrets are read from the *File settings on every probe so they can be rotated without a reload
+type HTTPAuth struct {
+	Username        string
+	Password        string
+	PasswordFile    string
+	BearerToken     string
+	BearerTokenFile string
+	OAuth2          *OAuth2
+}
+
+// OAuth2 client credentials flow settings
+type OAuth2 struct {
+	ClientID         string
+	ClientSecret     string
+	ClientSecretFile string
+	TokenURL         string
+	Scopes           []string
+	EndpointParams   map[string]string
+	secret           string
+	tokenSource      oauth2.TokenSource
+	sync.Mutex
+}
+
+// apply sets the authentication header on the request, the OAuth2 token is requested from the source IP and through the proxy of the target
+func (a *HTTPAuth) apply(req *http.Request, srcAddr string, proxy *HTTPProxy, timeout time.Duration) error {
+	if a == nil {
+		return nil
+	}
+
+	if a.OAuth2 != nil {
+		token, err := a.OAuth2.token(srcAddr, proxy, timeout)
+		if err != nil {
+			return fmt.Errorf("oauth2 token: %v", err)
+		}
+		token.SetAuthHeader(req)
+		return nil
+	}
+
+	if a.BearerToken != "" || a.BearerTokenFile != "" {
+		token, err := readSecret(a.BearerToken, a.BearerTokenFile)
+		if err != nil {
+			return fmt.Errorf("bearer token: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+
+	if a.Username != "" {
+		password, err := readSecret(a.Password, a.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("basic auth password: %v", err)
+		}
+		req.SetBasicAuth(a.Username, password)
+	}
+	return nil
+}
+
+// token returns a cached token, a new one is requested when it has expired or the client secret changed
+func (o *OAuth2) token(srcAddr string, proxy *HTTPProxy, timeout time.Duration) (*oauth2.Token, error) {
+	secret, err := readSecret(o.ClientSecret, o.ClientSecretFile)
+	if err != nil {
+		return nil, err
+	}
+
+	o.Lock()
+	defer o.Unlock()
+
+	if o.tokenSource == nil || secret != o.secret {
+		params := url.Values{}
+		for k, v := range o.EndpointParams {
+			params.Set(k, v)
+		}
+		cfg := &clientcredentials.Config{
+			ClientID:       o.ClientID,
+			ClientSecret:   secret,
+			TokenURL:       o.TokenURL,
+			Scopes:         o.Scopes,
+			EndpointParams: params,
+		}
+		tokenURL, err := url.Parse(o.TokenURL)
+		if err != nil {
+			return nil, err
+		}
+		transport, err := newTransport(srcAddr, tokenURL.Hostname(), "", proxy, "")
+		if err != nil {
+			return nil, err
+		}
+		// The token requests are rare, their connections are not kept
+		if t, ok := transport.(*http.Transport); ok {
+			t.DisableKeepAlives = true
+		}
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: transport, Timeout: timeout})
+		o.tokenSource = cfg.TokenSource(ctx)
+		o.secret = secret
+	}
+	return o.tokenSource.Token()
+}
+
+// readSecret returns the inline secret or the trimmed content of the secret file
+func readSecret(secret string, file string) (string, error) {
+	if file == "" {
+		return secret, nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
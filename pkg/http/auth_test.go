@@ -0,0 +1,201 @@
+package http
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tokenServer OAuth2 token endpoint, the access token is derived from the client secret
+type tokenServer struct {
+	mtx     sync.Mutex
+	clients []string
+}
+
+func (s *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if err := r.ParseForm(); err != nil || r.Method != "POST" || r.Form.Get("grant_type") != "client_credentials" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if !ok {
+		id, secret = r.Form.Get("client_id"), r.Form.Get("client_secret")
+	}
+	if id != "client" {
+		http.Error(w, "invalid client", http.StatusUnauthorized)
+		return
+	}
+
+	s.mtx.Lock()
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+	s.clients = append(s.clients, host)
+	s.mtx.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "token-" + secret,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+}
+
+func (s *tokenServer) requests() []string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]string{}, s.clients...)
+}
+
+// authServer target that records the Authorization header of the last request
+type authServer struct {
+	mtx           sync.Mutex
+	authorization string
+}
+
+func (s *authServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.authorization = r.Header.Get("Authorization")
+}
+
+func (s *authServer) last() string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.authorization
+}
+
+func oauth2Options(tokenURL string, secretFile string) *HTTPOptions {
+	options := defaultOptions()
+	options.Auth = &HTTPAuth{OAuth2: &OAuth2{ClientID: "client", ClientSecretFile: secretFile, TokenURL: tokenURL}}
+	return options
+}
+
+func writeSecret(t *testing.T, file string, secret string) {
+	t.Helper()
+	if err := os.WriteFile(file, []byte(secret+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOAuth2Token(t *testing.T) {
+	tokens := &tokenServer{}
+	tokenSrv := httptest.NewServer(tokens)
+	defer tokenSrv.Close()
+	target := &authServer{}
+	targetSrv := httptest.NewServer(target)
+	defer targetSrv.Close()
+
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	writeSecret(t, secretFile, "secret1")
+	options := oauth2Options(tokenSrv.URL, secretFile)
+
+	for i := 0; i < 2; i++ {
+		if _, err := HTTPGet(targetSrv.URL, "", 5*time.Second, options); err != nil {
+			t.Fatal(err)
+		}
+		if got := target.last(); got != "Bearer token-secret1" {
+			t.Errorf("request %d: Authorization: got %q", i, got)
+		}
+	}
+	// The token is cached until it expires
+	if n := len(tokens.requests()); n != 1 {
+		t.Errorf("token requests: got %d, want 1", n)
+	}
+
+	// A new client secret requests a new token
+	writeSecret(t, secretFile, "secret2")
+	if _, err := HTTPGet(targetSrv.URL, "", 5*time.Second, options); err != nil {
+		t.Fatal(err)
+	}
+	if got := target.last(); got != "Bearer token-secret2" {
+		t.Errorf("rotated secret: Authorization: got %q", got)
+	}
+	if n := len(tokens.requests()); n != 2 {
+		t.Errorf("token requests: got %d, want 2", n)
+	}
+}
+
+func TestOAuth2TokenError(t *testing.T) {
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid client", http.StatusUnauthorized)
+	}))
+	defer tokenSrv.Close()
+	target := &authServer{}
+	targetSrv := httptest.NewServer(target)
+	defer targetSrv.Close()
+
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	writeSecret(t, secretFile, "secret1")
+
+	out, err := HTTPGet(targetSrv.URL, "", 5*time.Second, oauth2Options(tokenSrv.URL, secretFile))
+	if err == nil || out.Success {
+		t.Fatalf("got success with a rejected token request")
+	}
+}
+
+func TestOAuth2TokenSourceIP(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the source ip 127.0.0.2 is only available on the Linux loopback")
+	}
+	tokens := &tokenServer{}
+	tokenSrv := httptest.NewServer(tokens)
+	defer tokenSrv.Close()
+	targetSrv := httptest.NewServer(&authServer{})
+	defer targetSrv.Close()
+
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	writeSecret(t, secretFile, "secret1")
+
+	if _, err := HTTPGet(targetSrv.URL, "127.0.0.2", 5*time.Second, oauth2Options(tokenSrv.URL, secretFile)); err != nil {
+		t.Fatal(err)
+	}
+	if got := tokens.requests(); len(got) != 1 || got[0] != "127.0.0.2" {
+		t.Errorf("token request source ip: got %v, want 127.0.0.2", got)
+	}
+}
+
+func TestOAuth2TokenProxy(t *testing.T) {
+	tokenSrv := httptest.NewServer(&tokenServer{})
+	defer tokenSrv.Close()
+	target := &authServer{}
+	targetSrv := httptest.NewServer(target)
+	defer targetSrv.Close()
+
+	// Forward proxy recording the requested hosts
+	var mtx sync.Mutex
+	proxied := []string{}
+	proxySrv := httptest.NewServer(&httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			mtx.Lock()
+			proxied = append(proxied, r.In.URL.Path)
+			mtx.Unlock()
+			r.SetURL(&url.URL{Scheme: "http", Host: r.In.URL.Host})
+		},
+	})
+	defer proxySrv.Close()
+
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	writeSecret(t, secretFile, "secret1")
+	options := oauth2Options(tokenSrv.URL+"/token", secretFile)
+	options.Proxy = &HTTPProxy{URL: proxySrv.URL}
+
+	if _, err := HTTPGet(targetSrv.URL+"/target", "", 5*time.Second, options); err != nil {
+		t.Fatal(err)
+	}
+	if got := target.last(); got != "Bearer token-secret1" {
+		t.Errorf("Authorization: got %q", got)
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	if len(proxied) != 2 || proxied[0] != "/token" || proxied[1] != "/target" {
+		t.Errorf("proxied requests: got %v, want [/token /target]", proxied)
+	}
+}
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
@@ -14,221 +15,265 @@ import (
 
 var (
 	// Reusable HTTP transports for connection pooling
-	defaultTransport     *http.Transport
-	defaultTransportOnce sync.Once
-	// Transport cache for source IP specific transports
-	sourceIPTransports     = make(map[string]*http.Transport)
-	sourceIPTransportMutex sync.RWMutex
-	// Transport cache for proxy transports
-	proxyTransports     = make(map[string]*http.Transport)
-	proxyTransportMutex sync.RWMutex
+	// Transports are cached per source IP, destination IP, proxy settings and HTTP version
+	transports     = make(map[string]http.RoundTripper)
+	transportRefs  = make(map[string]int)
+	transportMutex sync.RWMutex
 )
 
-// getDefaultTransport returns a singleton HTTP transport with connection pooling
-func getDefaultTransport() *http.Transport {
-	defaultTransportOnce.Do(func() {
-		defaultTransport = &http.Transport{
-			MaxIdleConns:        100,
-			MaxIdleConnsPerHost: 10,
-			IdleConnTimeout:     90 * time.Second,
-			MaxConnsPerHost:     0,
-		}
-	})
-	return defaultTransport
+// transportKey returns the transport cache key of the settings
+func transportKey(srcAddr string, destHost string, destIP string, proxy *HTTPProxy, httpVersion string) string {
+	return srcAddr + "|" + destHost + "|" + destIP + "|" + proxy.key() + "|" + httpVersion
+}
+
+// optionsKey returns the transport cache key of a request
+func optionsKey(destURL string, srcAddr string, options *HTTPOptions) string {
+	if options == nil {
+		options = defaultOptions()
+	}
+	destHost := ""
+	if dURL, err := url.Parse(destURL); err == nil {
+		destHost = dURL.Hostname()
+	}
+	return transportKey(srcAddr, destHost, options.DestIP, options.Proxy, options.HTTPVersion)
 }
 
-// getSourceIPTransport returns or creates a transport for a specific source IP
-func getSourceIPTransport(srcAddr string) *http.Transport {
-	sourceIPTransportMutex.RLock()
-	transport, exists := sourceIPTransports[srcAddr]
-	sourceIPTransportMutex.RUnlock()
+// RetainTransport registers a target that uses the transport of the request settings
+func RetainTransport(destURL string, srcAddr string, options *HTTPOptions) {
+	key := optionsKey(destURL, srcAddr, options)
 
-	if exists {
-		return transport
+	transportMutex.Lock()
+	defer transportMutex.Unlock()
+	transportRefs[key]++
+}
+
+// ReleaseTransport unregisters a target, the transport is closed and dropped from the cache once no target uses it
+func ReleaseTransport(destURL string, srcAddr string, options *HTTPOptions) {
+	key := optionsKey(destURL, srcAddr, options)
+
+	transportMutex.Lock()
+	defer transportMutex.Unlock()
+	if transportRefs[key] > 1 {
+		transportRefs[key]--
+		return
 	}
+	delete(transportRefs, key)
 
-	// Create new transport for this source IP
-	sourceIPTransportMutex.Lock()
-	defer sourceIPTransportMutex.Unlock()
+	closeTransport(transports[key])
+	delete(transports, key)
+}
 
-	// Double-check after acquiring write lock
-	if transport, exists := sourceIPTransports[srcAddr]; exists {
-		return transport
-	}
-
-	srcIp := net.ParseIP(srcAddr)
-	transport = &http.Transport{
-		DialContext: (&net.Dialer{
-			LocalAddr: &net.TCPAddr{
-				IP:   srcIp,
-				Port: 0,
-			},
-		}).DialContext,
-		MaxIdleConns:        100,
-		MaxIdleConnsPerHost: 10,
-		IdleConnTimeout:     90 * time.Second,
-		MaxConnsPerHost:     0,
+// closeTransport closes the idle connections of a transport, and the UDP socket of the HTTP/3 transports
+func closeTransport(transport http.RoundTripper) {
+	switch t := transport.(type) {
+	case *h3Transport:
+		t.Close()
+	case *http.Transport:
+		t.CloseIdleConnections()
 	}
-	sourceIPTransports[srcAddr] = transport
-	return transport
 }
 
-// getProxyTransport returns or creates a transport for a specific proxy URL
-func getProxyTransport(proxyURL string) (*http.Transport, error) {
-	proxyTransportMutex.RLock()
-	transport, exists := proxyTransports[proxyURL]
-	proxyTransportMutex.RUnlock()
+// getTransport returns or creates a transport for a specific source IP, destination IP, proxy settings and HTTP version
+// The transports are only cached while a target retains them, otherwise cached is false and the caller closes the transport after the request
+func getTransport(srcAddr string, destHost string, destIP string, proxy *HTTPProxy, httpVersion string) (transport http.RoundTripper, cached bool, err error) {
+	key := transportKey(srcAddr, destHost, destIP, proxy, httpVersion)
+
+	transportMutex.RLock()
+	transport, exists := transports[key]
+	transportMutex.RUnlock()
 
 	if exists {
-		return transport, nil
+		return transport, true, nil
 	}
 
-	// Create new transport for this proxy
-	proxyTransportMutex.Lock()
-	defer proxyTransportMutex.Unlock()
+	// Create new transport
+	transportMutex.Lock()
+	defer transportMutex.Unlock()
 
 	// Double-check after acquiring write lock
-	if transport, exists := proxyTransports[proxyURL]; exists {
-		return transport, nil
+	if transport, exists := transports[key]; exists {
+		return transport, true, nil
 	}
 
-	pURL, err := url.Parse(proxyURL)
+	transport, err = newTransport(srcAddr, destHost, destIP, proxy, httpVersion)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	if transportRefs[key] == 0 {
+		return transport, false, nil
+	}
+	transports[key] = transport
+	return transport, true, nil
+}
+
+// newTransport creates a transport with connection pooling
+// If destIP is specified the connections to destHost are made to destIP instead of a resolved address
+func newTransport(srcAddr string, destHost string, destIP string, proxy *HTTPProxy, httpVersion string) (http.RoundTripper, error) {
+	if destIP != "" && proxy != nil {
+		return nil, fmt.Errorf("destination ip %v can not be used with a proxy", destIP)
 	}
 
-	transport = &http.Transport{
-		Proxy:               http.ProxyURL(pURL),
+	if httpVersion == HTTPVersion3 {
+		if proxy != nil {
+			return nil, fmt.Errorf("http version %v can not be used with a proxy", httpVersion)
+		}
+		transport, err := newHTTP3Transport(srcAddr, destHost, destIP)
+		if err != nil {
+			return nil, err
+		}
+		return transport, nil
+	}
+
+	transport := &http.Transport{
 		MaxIdleConns:        100,
 		MaxIdleConnsPerHost: 10,
 		IdleConnTimeout:     90 * time.Second,
 		MaxConnsPerHost:     0,
 	}
-	proxyTransports[proxyURL] = transport
+
+	dialer := &net.Dialer{}
+	if srcAddr != "" {
+		dialer.LocalAddr = &net.TCPAddr{
+			IP:   net.ParseIP(srcAddr),
+			Port: 0,
+		}
+		transport.DialContext = dialer.DialContext
+	}
+
+	if destIP != "" {
+		transport.DialContext = func(ctx context.Context, network string, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, pinAddr(addr, destHost, destIP))
+		}
+	}
+
+	if proxy != nil {
+		if err := setProxy(transport, dialer, proxy); err != nil {
+			return nil, err
+		}
+	}
+
+	// Keep HTTP/2 negotiation of the transports without a source IP, a custom dialer disables it by default
+	if destIP != "" || proxy != nil {
+		transport.ForceAttemptHTTP2 = srcAddr == ""
+	}
+
+	switch httpVersion {
+	case HTTPVersion1:
+		protocols := &http.Protocols{}
+		protocols.SetHTTP1(true)
+		transport.Protocols = protocols
+	case HTTPVersion2:
+		// h2 for https and h2c (prior knowledge) for http
+		protocols := &http.Protocols{}
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+		transport.Protocols = protocols
+	case "":
+	default:
+		return nil, fmt.Errorf("unsupported http version: %v", httpVersion)
+	}
+
 	return transport, nil
 }
 
 // HTTPGet Http Get Trace Operation
-func HTTPGet(destURL string, srcAddr string, timeout time.Duration) (*HTTPReturn, error) {
+func HTTPGet(destURL string, srcAddr string, timeout time.Duration, options *HTTPOptions) (*HTTPReturn, error) {
 	var out HTTPReturn
 	var err error
 	out.DestAddr = destURL
 
+	if options == nil {
+		options = defaultOptions()
+	}
+	out.DestIP = options.DestIP
+
 	dURL, err := url.Parse(destURL)
 	if err != nil {
 		out.Success = false
 		return &out, err
 	}
 
-	// Reuse transport for connection pooling
-	var transport *http.Transport
 	if srcAddr != "" {
 		srcIp := net.ParseIP(srcAddr)
 		if srcIp == nil {
 			out.Success = false
 			return &out, fmt.Errorf("source ip: %v is invalid, HTTP target: %v", srcAddr, destURL)
 		}
-		transport = getSourceIPTransport(srcAddr)
-	} else {
-		transport = getDefaultTransport()
 	}
 
-	client := &http.Client{
-		Timeout:   timeout,
-		Transport: transport,
-	}
-
-	req, err := http.NewRequest("GET", dURL.String(), nil)
-	if err != nil {
-		out.Success = false
-		return &out, err
+	if options.DestIP != "" {
+		if net.ParseIP(options.DestIP) == nil {
+			out.Success = false
+			return &out, fmt.Errorf("destination ip: %v is invalid, HTTP target: %v", options.DestIP, destURL)
+		}
 	}
 
-	trace, ht := NewClientTrace()
-	ctx := httptrace.WithClientTrace(req.Context(), trace)
-	req = req.WithContext(ctx)
-	req.Close = true
-
-	resp, err := client.Do(req)
+	// Reuse transport for connection pooling
+	transport, cached, err := getTransport(srcAddr, dURL.Hostname(), options.DestIP, options.Proxy, options.HTTPVersion)
 	if err != nil {
 		out.Success = false
 		return &out, err
 	}
-
-	// Read
-	defer resp.Body.Close()
-	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
-		out.Success = false
-		return &out, err
+	if !cached {
+		defer closeTransport(transport)
 	}
 
-	ht.Finish()
-	stats := ht.Stats()
-
-	out.Success = true
-	out.Status = resp.StatusCode
-	out.ContentLength = resp.ContentLength
-	out.DNSLookup = stats.DNSLookup
-	out.TCPConnection = stats.TCPConnection
-	out.TLSHandshake = stats.TLSHandshake
-	if resp.TLS != nil {
-		out.TLSVersion = getTLSVersion(resp.TLS)
-		out.TLSEarliestCertExpiry = getEarliestCertExpiry(resp.TLS)
-		out.TLSLastChainExpiry = getLastChainExpiry(resp.TLS)
-	}
-	out.ServerProcessing = stats.ServerProcessing
-	out.ContentTransfer = stats.ContentTransfer
-	out.Total = stats.Total
-
-	return &out, nil
+	return httpGet(&out, dURL, srcAddr, transport, timeout, options)
 }
 
 // HTTPGetProxy Http Get Trace Operation with proxy
-func HTTPGetProxy(destURL string, timeout time.Duration, proxyURL string) (*HTTPReturn, error) {
-	var out HTTPReturn
-	var err error
-	out.DestAddr = destURL
-
-	dURL, err := url.Parse(destURL)
-	if err != nil {
-		out.Success = false
-		return &out, err
-	}
+// Deprecated: Use HTTPGet with HTTPOptions.Proxy, which can be combined with a source IP
+func HTTPGetProxy(destURL string, timeout time.Duration, proxyURL string, options *HTTPOptions) (*HTTPReturn, error) {
+	opts := defaultOptions()
+	if options != nil {
+		*opts = *options
+	}
+	opts.Proxy = &HTTPProxy{URL: proxyURL}
+	return HTTPGet(destURL, "", timeout, opts)
+}
 
-	// Reuse transport for connection pooling
-	transport, err := getProxyTransport(proxyURL)
-	if err != nil {
-		out.Success = false
-		return &out, err
+// httpGet runs the traced GET request with the given transport and fills out
+func httpGet(out *HTTPReturn, dURL *url.URL, srcAddr string, transport http.RoundTripper, timeout time.Duration, options *HTTPOptions) (*HTTPReturn, error) {
+	// HTTP/3 connections are not closed by req.Close, drop them so every probe measures a new connection
+	if h3, ok := transport.(*h3Transport); ok {
+		defer h3.CloseIdleConnections()
 	}
 
 	client := &http.Client{
-		Transport: transport,
-		Timeout:   timeout,
+		Transport:     transport,
+		Timeout:       timeout,
+		CheckRedirect: redirectPolicy(out, options),
 	}
 
 	req, err := http.NewRequest("GET", dURL.String(), nil)
 	if err != nil {
 		out.Success = false
-		return &out, err
+		return out, err
+	}
+
+	// Authenticate before the trace starts, fetching a token is not part of the probe timings
+	if err := options.Auth.apply(req, srcAddr, options.Proxy, timeout); err != nil {
+		out.Success = false
+		return out, err
 	}
 
 	trace, ht := NewClientTrace()
 	ctx := httptrace.WithClientTrace(req.Context(), trace)
+	ctx = context.WithValue(ctx, traceContextKey{}, ht)
 	req = req.WithContext(ctx)
 	req.Close = true
 
 	resp, err := client.Do(req)
 	if err != nil {
 		out.Success = false
-		return &out, err
+		return out, err
 	}
 
 	// Read
 	defer resp.Body.Close()
 	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
 		out.Success = false
-		return &out, err
+		return out, err
 	}
 
 	ht.Finish()
@@ -236,9 +281,12 @@ func HTTPGetProxy(destURL string, timeout time.Duration, proxyURL string) (*HTTP
 
 	out.Success = true
 	out.Status = resp.StatusCode
+	out.Protocol = resp.Proto
+	out.FinalURL = resp.Request.URL.String()
 	out.ContentLength = resp.ContentLength
 	out.DNSLookup = stats.DNSLookup
 	out.TCPConnection = stats.TCPConnection
+	out.ProxyConnect = stats.ProxyConnect
 	out.TLSHandshake = stats.TLSHandshake
 	if resp.TLS != nil {
 		out.TLSVersion = getTLSVersion(resp.TLS)
@@ -249,7 +297,53 @@ func HTTPGetProxy(destURL string, timeout time.Duration, proxyURL string) (*HTTP
 	out.ContentTransfer = stats.ContentTransfer
 	out.Total = stats.Total
 
-	return &out, nil
+	return out, nil
+}
+
+// pinAddr replaces the host of addr with destIP if it is destHost, other hosts (redirects) are resolved as usual
+func pinAddr(addr string, destHost string, destIP string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host != destHost {
+		return addr
+	}
+	return net.JoinHostPort(destIP, port)
+}
+
+// defaultOptions returns the options used when none are given
+func defaultOptions() *HTTPOptions {
+	return &HTTPOptions{FollowRedirects: true, MaxRedirects: defaultMaxRedirects}
+}
+
+// redirectPolicy records every followed redirect hop into out and enforces the follow/max redirect options
+func redirectPolicy(out *HTTPReturn, options *HTTPOptions) func(req *http.Request, via []*http.Request) error {
+	hopStart := time.Now()
+	return func(req *http.Request, via []*http.Request) error {
+		prev := via[len(via)-1]
+		hop := HTTPRedirect{
+			URL:      prev.URL.String(),
+			Location: req.URL.String(),
+			Elapsed:  time.Since(hopStart),
+		}
+		if req.Response != nil {
+			hop.Status = req.Response.StatusCode
+		}
+
+		if !options.FollowRedirects {
+			return http.ErrUseLastResponse
+		}
+		for _, v := range via {
+			if v.URL.String() == req.URL.String() {
+				return fmt.Errorf("redirect loop detected at %v", req.URL)
+			}
+		}
+		if len(via) > options.MaxRedirects {
+			return fmt.Errorf("stopped after %d redirects", options.MaxRedirects)
+		}
+		// Only the followed hops are recorded
+		out.Redirects = append(out.Redirects, hop)
+		hopStart = time.Now()
+		return nil
+	}
 }
 
 // NewClientTrace http client trace
@@ -339,6 +433,9 @@ func (ht *HTTPTrace) Stats() (stats *HTTPTimelineStats) {
 	if !ht.ConnectStart.IsZero() && !ht.ConnectDone.IsZero() {
 		stats.TCPConnection = ht.ConnectDone.Sub(ht.ConnectStart)
 	}
+	if !ht.ConnectDone.IsZero() && !ht.ProxyConnectDone.IsZero() {
+		stats.ProxyConnect = ht.ProxyConnectDone.Sub(ht.ConnectDone)
+	}
 	if !ht.TLSHandshakeStart.IsZero() && !ht.TLSHandshakeDone.IsZero() {
 		stats.TLSHandshake = ht.TLSHandshakeDone.Sub(ht.TLSHandshakeStart)
 	}
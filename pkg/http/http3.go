@@ -0,0 +1,86 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// h3Transport HTTP/3 transport with the QUIC transport and UDP socket of its dialer
+// http3.Transport.Close doesn't close a QUIC transport it didn't create
+type h3Transport struct {
+	*http3.Transport
+	quic *quic.Transport
+	conn *net.UDPConn
+}
+
+// Close closes the QUIC connections, the QUIC transport and its UDP socket
+func (t *h3Transport) Close() error {
+	err := t.Transport.Close()
+	if t.quic != nil {
+		t.quic.Close()
+		t.conn.Close()
+	}
+	return err
+}
+
+// newHTTP3Transport creates a HTTP/3 (QUIC) transport, bound to the source IP and connecting to destIP (for destHost) if specified
+func newHTTP3Transport(srcAddr string, destHost string, destIP string) (*h3Transport, error) {
+	transport := &h3Transport{Transport: &http3.Transport{}}
+	if srcAddr == "" && destIP == "" {
+		return transport, nil
+	}
+
+	var srcIp net.IP
+	if srcAddr != "" {
+		srcIp = net.ParseIP(srcAddr)
+	}
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: srcIp, Port: 0})
+	if err != nil {
+		return nil, fmt.Errorf("listening on source ip: %v", err)
+	}
+	quicTransport := &quic.Transport{Conn: udpConn}
+	transport.quic = quicTransport
+	transport.conn = udpConn
+
+	transport.Dial = func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+		if destIP != "" {
+			addr = pinAddr(addr, destHost, destIP)
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		udpAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(host, port))
+		if err != nil {
+			return nil, err
+		}
+
+		// Same trace events as the default http3 dialer
+		trace := httptrace.ContextClientTrace(ctx)
+		if trace != nil && trace.ConnectStart != nil {
+			trace.ConnectStart("udp", udpAddr.String())
+		}
+		if trace != nil && trace.TLSHandshakeStart != nil {
+			trace.TLSHandshakeStart()
+		}
+		conn, err := quicTransport.DialEarly(ctx, udpAddr, tlsCfg, cfg)
+		if trace != nil && trace.TLSHandshakeDone != nil {
+			var state tls.ConnectionState
+			if conn != nil {
+				state = conn.ConnectionState().TLS
+			}
+			trace.TLSHandshakeDone(state, err)
+		}
+		if trace != nil && trace.ConnectDone != nil {
+			trace.ConnectDone("udp", udpAddr.String(), err)
+		}
+		return conn, err
+	}
+	return transport, nil
+}
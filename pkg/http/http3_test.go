@@ -0,0 +1,63 @@
+package http
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// udpClosed reports if the UDP socket of a HTTP/3 transport is closed
+func udpClosed(t *testing.T, transport *h3Transport) bool {
+	t.Helper()
+	if transport.conn == nil {
+		t.Fatal("HTTP/3 transport without its own UDP socket")
+	}
+	return errors.Is(transport.conn.SetReadDeadline(time.Now()), net.ErrClosed)
+}
+
+func TestHTTP3TransportRelease(t *testing.T) {
+	destURL := "https://localhost/"
+	options := defaultOptions()
+	options.HTTPVersion = HTTPVersion3
+	options.DestIP = "127.0.0.1"
+
+	RetainTransport(destURL, "127.0.0.1", options)
+	rt, cached, err := getTransport("127.0.0.1", "localhost", options.DestIP, options.Proxy, options.HTTPVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cached {
+		t.Fatal("retained transport not cached")
+	}
+	transport := rt.(*h3Transport)
+	if udpClosed(t, transport) {
+		t.Fatal("UDP socket closed while the transport is retained")
+	}
+
+	ReleaseTransport(destURL, "127.0.0.1", options)
+	if !udpClosed(t, transport) {
+		t.Error("UDP socket not closed after the transport was released")
+	}
+	transportMutex.RLock()
+	defer transportMutex.RUnlock()
+	if _, found := transports[optionsKey(destURL, "127.0.0.1", options)]; found {
+		t.Error("released transport still cached")
+	}
+}
+
+func TestHTTP3TransportUncached(t *testing.T) {
+	rt, cached, err := getTransport("127.0.0.1", "localhost", "127.0.0.1", nil, HTTPVersion3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached {
+		t.Fatal("transport without a target cached")
+	}
+	transport := rt.(*h3Transport)
+
+	closeTransport(transport)
+	if !udpClosed(t, transport) {
+		t.Error("UDP socket not closed after the request")
+	}
+}
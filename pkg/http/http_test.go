@@ -0,0 +1,61 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// redirectServer redirects /N to /N-1 until /0
+func redirectServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		if n > 0 {
+			http.Redirect(w, r, "/"+strconv.Itoa(n-1), http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestRedirects(t *testing.T) {
+	srv := redirectServer()
+	defer srv.Close()
+
+	tests := []struct {
+		name      string
+		follow    bool
+		max       int
+		path      string
+		success   bool
+		status    int
+		redirects int
+	}{
+		{name: "followed", follow: true, max: 10, path: "/3", success: true, status: http.StatusOK, redirects: 3},
+		{name: "not followed", follow: false, max: 10, path: "/3", success: true, status: http.StatusFound, redirects: 0},
+		{name: "max redirects", follow: true, max: 2, path: "/3", success: false, redirects: 2},
+		{name: "max redirects 0", follow: true, max: 0, path: "/1", success: false, redirects: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := defaultOptions()
+			options.FollowRedirects = tt.follow
+			options.MaxRedirects = tt.max
+
+			out, err := HTTPGet(srv.URL+tt.path, "", 5*time.Second, options)
+			if out.Success != tt.success {
+				t.Fatalf("success: got %v, want %v (err: %v)", out.Success, tt.success, err)
+			}
+			if tt.success && out.Status != tt.status {
+				t.Errorf("status: got %d, want %d", out.Status, tt.status)
+			}
+			if len(out.Redirects) != tt.redirects {
+				t.Errorf("redirects: got %d, want %d", len(out.Redirects), tt.redirects)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+// HTTPProxy Proxy settings
+// Supported proxy schemes: http, https, socks5 (destination resolved locally) and socks5h (destination resolved by the proxy)
+type HTTPProxy struct {
+	URL             string
+	Username        string
+	Password        string
+	PasswordFile    string
+	NoProxy         []string
+	FromEnvironment bool
+	// Resolver of the socks5 destinations, the default resolver if nil (not part of the cache key, it is set once per process)
+	Resolver *net.Resolver
+}
+
+// traceContextKey Context key of the HTTPTrace, used to record the proxy connect phase
+type traceContextKey struct{}
+
+// key returns the transport cache key of the proxy settings
+// The transports keep the settings they were created with, the inline password is part of the key (hashed) so a new password gets a new transport
+func (p *HTTPProxy) key() string {
+	if p == nil {
+		return ""
+	}
+	password := sha256.Sum256([]byte(p.Password))
+	return fmt.Sprintf("%s|%s|%x|%s|%s|%v", p.URL, p.Username, password, p.PasswordFile, strings.Join(p.NoProxy, ","), p.FromEnvironment)
+}
+
+// proxyFunc returns the function selecting the proxy of a request URL, nil means a direct connection
+// Without no_proxy an explicit proxy is used for every request, otherwise the environment (HTTP_PROXY, HTTPS_PROXY and NO_PROXY) rules apply, which never proxy localhost
+func (p *HTTPProxy) proxyFunc() (func(*url.URL) (*url.URL, error), error) {
+	cfg := &httpproxy.Config{}
+	if p.FromEnvironment {
+		cfg = httpproxy.FromEnvironment()
+	} else {
+		pURL, err := url.Parse(p.URL)
+		if err != nil {
+			return nil, err
+		}
+		if pURL.Scheme != "http" && pURL.Scheme != "https" && pURL.Scheme != "socks5" && pURL.Scheme != "socks5h" {
+			return nil, fmt.Errorf("unsupported proxy scheme: %v", pURL.Scheme)
+		}
+		if len(p.NoProxy) == 0 {
+			return func(*url.URL) (*url.URL, error) {
+				u := *pURL
+				return &u, nil
+			}, nil
+		}
+		cfg.HTTPProxy = p.URL
+		cfg.HTTPSProxy = p.URL
+	}
+	if len(p.NoProxy) > 0 {
+		cfg.NoProxy = strings.Join(append([]string{cfg.NoProxy}, p.NoProxy...), ",")
+	}
+	return cfg.ProxyFunc(), nil
+}
+
+// userinfo returns the proxy credentials, the configured ones take precedence over the ones in the proxy URL
+func (p *HTTPProxy) userinfo(pURL *url.URL) (*url.Userinfo, error) {
+	if p.Username == "" {
+		return pURL.User, nil
+	}
+	password, err := readSecret(p.Password, p.PasswordFile)
+	if err != nil {
+		return nil, fmt.Errorf("proxy password: %v", err)
+	}
+	return url.UserPassword(p.Username, password), nil
+}
+
+// isSocks checks if the proxy is a SOCKS proxy
+func isSocks(pURL *url.URL) bool {
+	return pURL.Scheme == "socks5" || pURL.Scheme == "socks5h"
+}
+
+// setProxy configures the transport to use the proxy, HTTP proxies are handled by the transport itself and SOCKS proxies by its dialer
+func setProxy(transport *http.Transport, dialer *net.Dialer, p *HTTPProxy) error {
+	proxyFunc, err := p.proxyFunc()
+	if err != nil {
+		return err
+	}
+
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		pURL, err := proxyFunc(req.URL)
+		if err != nil || pURL == nil || isSocks(pURL) {
+			return nil, err
+		}
+		user, err := p.userinfo(pURL)
+		if err != nil {
+			return nil, err
+		}
+		pURL.User = user
+		return pURL, nil
+	}
+
+	transport.OnProxyConnectResponse = func(ctx context.Context, _ *url.URL, _ *http.Request, _ *http.Response) error {
+		proxyConnectDone(ctx)
+		return nil
+	}
+
+	transport.DialContext = func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		// The dialer does not know the request scheme, it is only used to pick HTTP_PROXY or HTTPS_PROXY from the environment
+		scheme := "http"
+		if _, port, err := net.SplitHostPort(addr); err == nil && port == "443" {
+			scheme = "https"
+		}
+		pURL, err := proxyFunc(&url.URL{Scheme: scheme, Host: addr})
+		if err != nil {
+			return nil, err
+		}
+		if pURL == nil || !isSocks(pURL) {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		return dialSocks(ctx, dialer, p, pURL, network, addr)
+	}
+
+	return nil
+}
+
+// dialSocks connects to the destination through the SOCKS proxy
+func dialSocks(ctx context.Context, dialer *net.Dialer, p *HTTPProxy, pURL *url.URL, network string, addr string) (net.Conn, error) {
+	var auth *proxy.Auth
+	user, err := p.userinfo(pURL)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		password, _ := user.Password()
+		auth = &proxy.Auth{User: user.Username(), Password: password}
+	}
+
+	// socks5 resolves the destination locally, socks5h leaves it to the proxy
+	if pURL.Scheme == "socks5" {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		resolver := p.Resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+		ipAddrs, err := resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(ipAddrs) == 0 {
+			return nil, fmt.Errorf("no addresses found for: %v", host)
+		}
+		addr = net.JoinHostPort(ipAddrs[0].IP.String(), port)
+	}
+
+	d, err := proxy.SOCKS5("tcp", pURL.Host, auth, dialer)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := d.(proxy.ContextDialer).DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	proxyConnectDone(ctx)
+	return conn, nil
+}
+
+// proxyConnectDone records the end of the proxy CONNECT / SOCKS handshake
+func proxyConnectDone(ctx context.Context) {
+	ht, ok := ctx.Value(traceContextKey{}).(*HTTPTrace)
+	if !ok {
+		return
+	}
+	ht.Lock()
+	defer ht.Unlock()
+	ht.ProxyConnectDone = time.Now()
+}
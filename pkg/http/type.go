@@ -5,27 +5,61 @@ import (
 	"time"
 )
 
+const defaultMaxRedirects = 10
+
+// Supported HTTP versions
+const (
+	HTTPVersion1 = "1.1"
+	HTTPVersion2 = "2"
+	HTTPVersion3 = "3"
+)
+
 // HTTPReturn Calculated results
 type HTTPReturn struct {
-	Success               bool          `json:"success"`
-	DestAddr              string        `json:"dest_address"`
-	Status                int           `json:"status,omitempty"`
-	ContentLength         int64         `json:"content_length,omitempty"`
-	DNSLookup             time.Duration `json:"dnsLookup,omitempty"`
-	TCPConnection         time.Duration `json:"tcpConnection,omitempty"`
-	TLSHandshake          time.Duration `json:"tlsHandshake,omitempty"`
-	TLSVersion            string        `json:"tlsVersion,omitempty"`
-	TLSEarliestCertExpiry time.Time     `json:"tlsEarliestCertExpiry,omitempty"`
-	TLSLastChainExpiry    time.Time     `json:"tlsLastChainExpiry,omitempty"`
-	ServerProcessing      time.Duration `json:"serverProcessing,omitempty"`
-	ContentTransfer       time.Duration `json:"contentTransfer,omitempty"`
-	Total                 time.Duration `json:"total,omitempty"`
+	Success               bool           `json:"success"`
+	DestAddr              string         `json:"dest_address"`
+	DestIP                string         `json:"dest_ip,omitempty"`
+	Status                int            `json:"status,omitempty"`
+	Protocol              string         `json:"protocol,omitempty"`
+	FinalURL              string         `json:"final_url,omitempty"`
+	Redirects             []HTTPRedirect `json:"redirects,omitempty"`
+	ContentLength         int64          `json:"content_length,omitempty"`
+	DNSLookup             time.Duration  `json:"dnsLookup,omitempty"`
+	TCPConnection         time.Duration  `json:"tcpConnection,omitempty"`
+	ProxyConnect          time.Duration  `json:"proxyConnect,omitempty"`
+	TLSHandshake          time.Duration  `json:"tlsHandshake,omitempty"`
+	TLSVersion            string         `json:"tlsVersion,omitempty"`
+	TLSEarliestCertExpiry time.Time      `json:"tlsEarliestCertExpiry,omitempty"`
+	TLSLastChainExpiry    time.Time      `json:"tlsLastChainExpiry,omitempty"`
+	ServerProcessing      time.Duration  `json:"serverProcessing,omitempty"`
+	ContentTransfer       time.Duration  `json:"contentTransfer,omitempty"`
+	Total                 time.Duration  `json:"total,omitempty"`
+}
+
+// HTTPRedirect Redirect hop details
+type HTTPRedirect struct {
+	URL      string        `json:"url"`
+	Location string        `json:"location"`
+	Status   int           `json:"status"`
+	Elapsed  time.Duration `json:"elapsed"`
+}
+
+// HTTPOptions HTTP Get Options
+type HTTPOptions struct {
+	FollowRedirects bool
+	MaxRedirects    int
+	HTTPVersion     string
+	Auth            *HTTPAuth
+	Proxy           *HTTPProxy
+	// DestIP is dialed instead of resolving the URL host, the Host header and TLS SNI are unchanged
+	DestIP string
 }
 
 // HTTPTimelineStats http timeline stats
 type HTTPTimelineStats struct {
 	DNSLookup        time.Duration `json:"dnsLookup,omitempty"`
 	TCPConnection    time.Duration `json:"tcpConnection,omitempty"`
+	ProxyConnect     time.Duration `json:"proxyConnect,omitempty"`
 	TLSHandshake     time.Duration `json:"tlsHandshake,omitempty"`
 	ServerProcessing time.Duration `json:"serverProcessing,omitempty"`
 	ContentTransfer  time.Duration `json:"contentTransfer,omitempty"`
@@ -49,6 +83,7 @@ type HTTPTrace struct {
 	DNSDone              time.Time     `json:"dnsDone,omitempty"`
 	ConnectStart         time.Time     `json:"connectStart,omitempty"`
 	ConnectDone          time.Time     `json:"connectDone,omitempty"`
+	ProxyConnectDone     time.Time     `json:"proxyConnectDone,omitempty"`
 	GotConnect           time.Time     `json:"gotConnect,omitempty"`
 	GotFirstResponseByte time.Time     `json:"gotFirstResponseByte,omitempty"`
 	TLSHandshakeStart    time.Time     `json:"tlsHandshakeStart,omitempty"`
@@ -4,15 +4,19 @@ import (
 	"bytes"
 	"fmt"
 	"math"
+	"math/rand"
+	"runtime"
+	"sync"
 	"time"
 
 	"github.com/syepes/network_exporter/pkg/common"
 	"github.com/syepes/network_exporter/pkg/icmp"
 	"github.com/syepes/network_exporter/pkg/tcp"
+	"github.com/syepes/network_exporter/pkg/udp"
 )
 
 // Mtr Return traceroute object
-func Mtr(addr string, srcAddr string, maxHops int, count int, timeout time.Duration, icmpID int, payloadSize int, protocol string, port string, ipv6 bool) (*MtrResult, error) {
+func Mtr(addr string, srcAddr string, maxHops int, count int, timeout time.Duration, icmpID int, payloadSize int, protocol string, port string, fixedPort bool, parallel int, ipv6 bool) (*MtrResult, error) {
 	var out MtrResult
 	var err error
 
@@ -20,8 +24,9 @@ func Mtr(addr string, srcAddr string, maxHops int, count int, timeout time.Durat
 	options.SetMaxHops(maxHops)
 	options.SetCount(count)
 	options.SetTimeout(timeout)
+	options.SetParallel(parallel)
 
-	out, err = runMtr(addr, srcAddr, icmpID, &options, payloadSize, protocol, port, ipv6)
+	out, err = runMtr(addr, srcAddr, icmpID, &options, payloadSize, protocol, port, fixedPort, ipv6)
 
 	if err == nil {
 		if len(out.Hops) == 0 {
@@ -35,17 +40,18 @@ func Mtr(addr string, srcAddr string, maxHops int, count int, timeout time.Durat
 }
 
 // MtrString Console print traceroute operation
-func MtrString(addr string, srcAddr string, maxHops int, count int, timeout time.Duration, icmpID int, payloadSize int, protocol string, port string, ipv6 bool) (result string, err error) {
+func MtrString(addr string, srcAddr string, maxHops int, count int, timeout time.Duration, icmpID int, payloadSize int, protocol string, port string, fixedPort bool, parallel int, ipv6 bool) (result string, err error) {
 	options := MtrOptions{}
 	options.SetMaxHops(maxHops)
 	options.SetCount(count)
 	options.SetTimeout(timeout)
+	options.SetParallel(parallel)
 
 	var out MtrResult
 	var buffer bytes.Buffer
 	buffer.WriteString(fmt.Sprintf("Start: %v, DestAddr: %v\n", time.Now().Format("2006-01-02 15:04:05"), addr))
 
-	out, err = runMtr(addr, srcAddr, icmpID, &options, payloadSize, protocol, port, ipv6)
+	out, err = runMtr(addr, srcAddr, icmpID, &options, payloadSize, protocol, port, fixedPort, ipv6)
 
 	if err == nil {
 		if len(out.Hops) == 0 {
@@ -57,6 +63,14 @@ func MtrString(addr string, srcAddr string, maxHops int, count int, timeout time
 		return buffer.String(), err
 	}
 
+	buffer.WriteString(Report(&out))
+
+	return buffer.String(), nil
+}
+
+// Report Formats the result as the classic mtr console table
+func Report(out *MtrResult) string {
+	var buffer bytes.Buffer
 	buffer.WriteString(fmt.Sprintf("%-3v %-48v  %10v%c  %10v  %10v  %10v  %10v  %10v\n", "", "HOST", "Loss", '%', "Snt", "Last", "Avg", "Best", "Worst"))
 
 	// Format the output of mtr according to the original linux mtr result
@@ -69,7 +83,7 @@ func MtrString(addr string, srcAddr string, maxHops int, count int, timeout time
 				hopStr = ""
 			}
 
-			buffer.WriteString(fmt.Sprintf("%-3d %-48v  %10.1f%c  %10v  %10.2f  %10.2f  %10.2f  %10.2f\n", hop.TTL, hop.AddressTo, hop.Loss, '%', hop.Snt, common.Time2Float(hop.LastTime), common.Time2Float(hop.AvgTime), common.Time2Float(hop.BestTime), common.Time2Float(hop.WorstTime)))
+			buffer.WriteString(fmt.Sprintf("%-3d %-48v  %10.1f%c  %10v  %10.2f  %10.2f  %10.2f  %10.2f\n", hop.TTL, hop.AddressTo, hop.Loss*100, '%', hop.Snt, common.Time2Float(hop.LastTime), common.Time2Float(hop.AvgTime), common.Time2Float(hop.BestTime), common.Time2Float(hop.WorstTime)))
 			lastHop = hop.TTL
 		} else {
 			if index != len(out.Hops)-1 {
@@ -80,60 +94,113 @@ func MtrString(addr string, srcAddr string, maxHops int, count int, timeout time
 			}
 		}
 	}
+	buffer.WriteString(fmt.Sprintf("Cycle: %v\n", out.CycleTime))
 
-	return buffer.String(), nil
+	return buffer.String()
 }
 
 // MTR
-func runMtr(destAddr string, srcAddr string, icmpID int, options *MtrOptions, payloadSize int, protocol string, port string, ipv6 bool) (result MtrResult, err error) {
+func runMtr(destAddr string, srcAddr string, icmpID int, options *MtrOptions, payloadSize int, protocol string, port string, fixedPort bool, ipv6 bool) (result MtrResult, err error) {
 	result.Hops = []common.IcmpHop{}
 	result.DestAddr = destAddr
+	start := time.Now()
+	result.StartTime = start
 
 	// Avoid collisions/interference caused by multiple coroutines initiating mtr
 	pid := icmpID
 	timeout := options.Timeout()
 	mtrReturns := make([]*MtrReturn, options.MaxHops()+1)
 
+	// Paris-style UDP keeps the same source and destination port for every probe of the run
+	srcPort := 0
+	if protocol == "udp" && fixedPort {
+		srcPort = 32768 + rand.Intn(28232)
+	}
+
+	// Number of TTLs probed at the same time (sliding window), the Paris-style UDP probes share the source port and can only be sent one at a time
+	// The connect based TCP traceroute (non Linux) can't match the Time Exceeded replies to their probe, its TTLs are probed one at a time
+	parallel := options.Parallel()
+	if parallel > options.MaxHops() {
+		parallel = options.MaxHops()
+	}
+	if (protocol == "udp" && fixedPort) || (protocol == "tcp" && runtime.GOOS != "linux") {
+		parallel = 1
+	}
+
+	probe := func(ttl int, seq int) (common.IcmpReturn, error) {
+		// Use TCP, UDP or ICMP based on protocol
+		switch protocol {
+		case "tcp":
+			return tcp.Traceroute(destAddr, port, srcAddr, ttl, timeout, ipv6)
+		case "udp":
+			dstPort, err := udp.ProbePort(port, seq, fixedPort)
+			if err != nil {
+				return common.IcmpReturn{}, err
+			}
+			return udp.Traceroute(destAddr, srcAddr, srcPort, dstPort, ttl, timeout, seq, payloadSize, ipv6)
+		default:
+			return icmp.Icmp(destAddr, srcAddr, ttl, pid, timeout, seq, payloadSize, ipv6)
+		}
+	}
+
+	// TTL of the destination, once known the higher TTLs are no longer probed
+	var mtx sync.Mutex
+	destTTL := options.MaxHops()
+
 	// Verify data packets
 	seq := 0
 	for snt := 0; snt < options.Count(); snt++ {
+		var wg sync.WaitGroup
+		window := make(chan struct{}, parallel)
+
 		for ttl := 1; ttl < options.MaxHops(); ttl++ {
+			// Sliding window, wait for a free slot before sending the next TTL
+			window <- struct{}{}
+
+			mtx.Lock()
+			if ttl > destTTL {
+				mtx.Unlock()
+				<-window
+				break
+			}
 			if mtrReturns[ttl] == nil {
 				mtrReturns[ttl] = &MtrReturn{ttl: ttl, host: "unknown", succSum: 0, success: false, lastTime: time.Duration(0), sumTime: time.Duration(0), bestTime: time.Duration(0), worstTime: time.Duration(0), avgTime: time.Duration(0)}
 			}
+			mtx.Unlock()
 
-			var hopReturn common.IcmpReturn
-			var err error
+			wg.Add(1)
+			go func(ttl int, seq int) {
+				defer wg.Done()
+				defer func() { <-window }()
 
-			// Use TCP or ICMP based on protocol
-			if protocol == "tcp" {
-				hopReturn, err = tcp.Traceroute(destAddr, port, srcAddr, ttl, timeout, ipv6)
-			} else {
-				hopReturn, err = icmp.Icmp(destAddr, srcAddr, ttl, pid, timeout, seq, payloadSize, ipv6)
-			}
-			seq++
-			if err != nil || !hopReturn.Success {
-				continue
-			}
+				hopReturn, err := probe(ttl, seq)
+				if err != nil || !hopReturn.Success {
+					return
+				}
 
-			mtrReturns[ttl].host = hopReturn.Addr
-			mtrReturns[ttl].lastTime = hopReturn.Elapsed
-			mtrReturns[ttl].allTime = append(mtrReturns[ttl].allTime, hopReturn.Elapsed)
-			mtrReturns[ttl].succSum = mtrReturns[ttl].succSum + 1
-			if mtrReturns[ttl].worstTime == time.Duration(0) || hopReturn.Elapsed > mtrReturns[ttl].worstTime {
-				mtrReturns[ttl].worstTime = hopReturn.Elapsed
-			}
-			if mtrReturns[ttl].bestTime == time.Duration(0) || hopReturn.Elapsed < mtrReturns[ttl].bestTime {
-				mtrReturns[ttl].bestTime = hopReturn.Elapsed
-			}
-			mtrReturns[ttl].sumTime += hopReturn.Elapsed
-			mtrReturns[ttl].avgTime = mtrReturns[ttl].sumTime / time.Duration(mtrReturns[ttl].succSum)
-			mtrReturns[ttl].success = true
+				mtx.Lock()
+				defer mtx.Unlock()
+				mtrReturns[ttl].host = hopReturn.Addr
+				mtrReturns[ttl].lastTime = hopReturn.Elapsed
+				mtrReturns[ttl].allTime = append(mtrReturns[ttl].allTime, hopReturn.Elapsed)
+				mtrReturns[ttl].succSum = mtrReturns[ttl].succSum + 1
+				if mtrReturns[ttl].worstTime == time.Duration(0) || hopReturn.Elapsed > mtrReturns[ttl].worstTime {
+					mtrReturns[ttl].worstTime = hopReturn.Elapsed
+				}
+				if mtrReturns[ttl].bestTime == time.Duration(0) || hopReturn.Elapsed < mtrReturns[ttl].bestTime {
+					mtrReturns[ttl].bestTime = hopReturn.Elapsed
+				}
+				mtrReturns[ttl].sumTime += hopReturn.Elapsed
+				mtrReturns[ttl].avgTime = mtrReturns[ttl].sumTime / time.Duration(mtrReturns[ttl].succSum)
+				mtrReturns[ttl].success = true
 
-			if common.IsEqualIP(hopReturn.Addr, destAddr) {
-				break
-			}
+				if common.IsEqualIP(hopReturn.Addr, destAddr) && ttl < destTTL {
+					destTTL = ttl
+				}
+			}(ttl, seq)
+			seq++
 		}
+		wg.Wait()
 	}
 
 	for index, mtrReturn := range mtrReturns {
@@ -141,7 +208,8 @@ func runMtr(destAddr string, srcAddr string, icmpID int, options *MtrOptions, pa
 			continue
 		}
 
-		if mtrReturn == nil {
+		// The TTLs sent in parallel beyond the destination are ignored
+		if mtrReturn == nil || index > destTTL {
 			break
 		}
 
@@ -175,6 +243,30 @@ func runMtr(destAddr string, srcAddr string, icmpID int, options *MtrOptions, pa
 		}
 	}
 
+	result.CycleTime = time.Since(start)
+	forwardLoss(&result)
+
 	// fmt.Printf("Mtr.result %+v\n", result)
 	return result, nil
 }
+
+// forwardLoss attributes the loss of the hops to the forwarding path
+// Routers rate limit the ICMP messages they generate, the loss of a hop is only "not forwarded" if it persists to the later hops and the destination
+// The forward loss of a hop is the lowest loss from the hop to the end of the path and the loss origin is the first hop where it begins (0 without loss)
+func forwardLoss(result *MtrResult) {
+	result.LossOriginTTL = 0
+	minLoss := 0.0
+	for i := len(result.Hops) - 1; i >= 0; i-- {
+		if i == len(result.Hops)-1 || result.Hops[i].Loss < minLoss {
+			minLoss = result.Hops[i].Loss
+		}
+		result.Hops[i].ForwardLoss = minLoss
+	}
+
+	for _, hop := range result.Hops {
+		if hop.ForwardLoss > 0 {
+			result.LossOriginTTL = hop.TTL
+			break
+		}
+	}
+}
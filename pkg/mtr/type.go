@@ -10,12 +10,16 @@ const defaultMaxHops = 30
 const defaultTimeout = 5 * time.Second
 const defaultPackerSize = 56
 const defaultCount = 10
+const defaultParallel = 1
 
 // MtrResult Calculated results
 type MtrResult struct {
 	DestAddr      string                         `json:"dest_address"`
+	StartTime     time.Time                      `json:"start_time"`
 	Hops          []common.IcmpHop               `json:"hops"`
 	HopSummaryMap map[string]*common.IcmpSummary `json:"hop_summary_map"`
+	CycleTime     time.Duration                  `json:"cycle_time"`
+	LossOriginTTL int                            `json:"loss_origin_ttl"`
 }
 
 // MtrReturn MTR Response
@@ -41,6 +45,7 @@ type MtrOptions struct {
 	timeout    time.Duration
 	packetSize int
 	count      int
+	parallel   int
 }
 
 // MaxHops Getter
@@ -94,3 +99,16 @@ func (options *MtrOptions) PacketSize() int {
 func (options *MtrOptions) SetPacketSize(packetSize int) {
 	options.packetSize = packetSize
 }
+
+// Parallel Getter
+func (options *MtrOptions) Parallel() int {
+	if options.parallel == 0 {
+		options.parallel = defaultParallel
+	}
+	return options.parallel
+}
+
+// SetParallel Setter
+func (options *MtrOptions) SetParallel(parallel int) {
+	options.parallel = parallel
+}
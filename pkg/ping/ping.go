@@ -38,7 +38,7 @@ func PingString(addr string, ip string, srcAddr string, count int, timeout time.
 	end := time.Now().UnixNano() / 1e6
 
 	buffer.WriteString(fmt.Sprintf("%v packets transmitted, %v packet loss, time %vms\n", count, pingResult.DropRate, end-begin))
-	buffer.WriteString(fmt.Sprintf("rtt min/avg/max = %v/%v/%v ms\n", common.Time2Float(pingResult.WorstTime), common.Time2Float(pingResult.AvgTime), common.Time2Float(pingResult.BestTime)))
+	buffer.WriteString(fmt.Sprintf("rtt min/avg/max = %v/%v/%v ms\n", common.Time2Float(pingResult.BestTime), common.Time2Float(pingResult.AvgTime), common.Time2Float(pingResult.WorstTime)))
 
 	result = buffer.String()
 
@@ -0,0 +1,93 @@
+package tcp
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"time"
+)
+
+// Query failure reasons
+const (
+	QueryFailureExpectTimeout  = "expect_timeout"
+	QueryFailureExpectMismatch = "expect_mismatch"
+	QueryFailureSend           = "send"
+	QueryFailureStartTLS       = "starttls"
+)
+
+// QueryResponse Send / Expect step of a TCP dialogue
+// Expect is matched against the received lines, Send is written followed by a newline and StartTLS upgrades the connection
+type QueryResponse struct {
+	Expect   *regexp.Regexp
+	Send     string
+	StartTLS bool
+}
+
+// dialogue Connection state of a query / response exchange, the connection is replaced on STARTTLS
+type dialogue struct {
+	conn       net.Conn
+	scanner    *bufio.Scanner
+	serverName string
+}
+
+// runQueryResponse runs the dialogue steps on the connection and records the time of each step
+func runQueryResponse(conn net.Conn, serverName string, steps []QueryResponse, out *TCPPortReturn) error {
+	d := &dialogue{conn: conn, scanner: bufio.NewScanner(conn), serverName: serverName}
+
+	for i, qr := range steps {
+		start := time.Now()
+		reason, err := d.step(qr)
+		out.QuerySteps = append(out.QuerySteps, TCPQueryStep{Step: i + 1, Elapsed: time.Since(start), Success: err == nil})
+		if err != nil {
+			out.QueryFailedStep = i + 1
+			out.QueryFailure = reason
+			return fmt.Errorf("query step %d: %v", i+1, err)
+		}
+	}
+
+	out.QuerySuccess = true
+	return nil
+}
+
+// step runs a single dialogue step (expect, send and starttls), on failure the reason is returned
+func (d *dialogue) step(qr QueryResponse) (string, error) {
+	if qr.Expect != nil {
+		matched := false
+		for d.scanner.Scan() {
+			if qr.Expect.Match(d.scanner.Bytes()) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			err := d.scanner.Err()
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return QueryFailureExpectTimeout, fmt.Errorf("timeout waiting for: %v", qr.Expect)
+			}
+			if err != nil {
+				return QueryFailureExpectMismatch, err
+			}
+			return QueryFailureExpectMismatch, fmt.Errorf("connection closed before matching: %v", qr.Expect)
+		}
+	}
+
+	if qr.Send != "" {
+		if _, err := fmt.Fprintf(d.conn, "%s\n", qr.Send); err != nil {
+			return QueryFailureSend, err
+		}
+	}
+
+	if qr.StartTLS {
+		tlsConn := tls.Client(d.conn, &tls.Config{ServerName: d.serverName})
+		if err := tlsConn.Handshake(); err != nil {
+			return QueryFailureStartTLS, err
+		}
+		d.conn = tlsConn
+		d.scanner = bufio.NewScanner(tlsConn)
+	}
+	return "", nil
+}
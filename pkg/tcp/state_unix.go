@@ -0,0 +1,13 @@
+//go:build !windows
+
+package tcp
+
+import (
+	"syscall"
+)
+
+// Errors of a failed connect
+var (
+	errRefused     error = syscall.ECONNREFUSED
+	errUnreachable       = []error{syscall.EHOSTUNREACH, syscall.ENETUNREACH}
+)
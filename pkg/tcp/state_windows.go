@@ -0,0 +1,13 @@
+//go:build windows
+
+package tcp
+
+import (
+	"syscall"
+)
+
+// Winsock errors of a failed connect (WSAECONNREFUSED, WSAEHOSTUNREACH and WSAENETUNREACH)
+var (
+	errRefused     error = syscall.Errno(10061)
+	errUnreachable       = []error{syscall.Errno(10065), syscall.Errno(10051)}
+)
@@ -1,23 +1,33 @@
 package tcp
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net"
 	"time"
+
+	"github.com/syepes/network_exporter/pkg/common"
 )
 
 // Port TCP Operation
-func Port(destAddr string, ip string, srcAddr string, port string, timeout time.Duration) (*TCPPortReturn, error) {
+// The connection is sampled count times, the latency statistics and loss are calculated over the successful connects
+// The expected state is open, closed (the connects are refused) or filtered (the connects are refused, unanswered or unreachable)
+// If queryResponse steps are specified they are run on the first established connection, STARTTLS verifies the certificate against destAddr
+func Port(destAddr string, ip string, srcAddr string, port string, expect string, count int, timeout time.Duration, queryResponse []QueryResponse) (*TCPPortReturn, error) {
 	var out TCPPortReturn
 	var d net.Dialer
 	var err error
 
 	tcpOptions := &TCPPortOptions{}
+	tcpOptions.SetCount(count)
 	tcpOptions.SetTimeout(timeout)
 
 	out.DestAddr = destAddr
 	out.DestIp = ip
 	out.DestPort = port
+	out.Expect = expect
+	out.SrcIp = "0.0.0.0"
 
 	if srcAddr != "" {
 		srcIp := net.ParseIP(srcAddr)
@@ -38,24 +48,110 @@ func Port(destAddr string, ip string, srcAddr string, port string, timeout time.
 		}
 	}
 
-	start := time.Now()
-	conn, err := d.Dial("tcp", net.JoinHostPort(ip, port))
-	out.ConTime = time.Since(start)
-	if err != nil {
-		out.SrcIp = "0.0.0.0"
-		out.Success = false
+	var allTime []time.Duration
+	var elapsed time.Duration
+	var queryErr error
+	for cnt := 0; cnt < tcpOptions.Count(); cnt++ {
+		start := time.Now()
+		conn, dialErr := d.Dial("tcp", net.JoinHostPort(ip, port))
+		elapsed = time.Since(start)
+
+		out.State = portState(dialErr)
+		if expect == "closed" || expect == "filtered" {
+			if dialErr == nil {
+				err = fmt.Errorf("port %v is open, TCP target: %v", port, destAddr)
+				conn.Close()
+				continue
+			}
+			// Only the refused connects prove a closed port, the other errors are failures
+			if out.State == "closed" || (out.State == "filtered" && expect == "filtered") {
+				allTime = append(allTime, elapsed)
+				continue
+			}
+			err = dialErr
+			continue
+		}
+
+		if dialErr != nil {
+			err = dialErr
+			continue
+		}
+
+		allTime = append(allTime, elapsed)
+		if len(allTime) == 1 {
+			out.SrcIp = conn.LocalAddr().(*net.TCPAddr).IP.String()
+			if len(queryResponse) > 0 {
+				queryErr = query(conn, destAddr, queryResponse, tcpOptions.Timeout(), &out)
+			}
+		}
+		conn.Close()
+	}
+
+	// Closed ports must refuse every connect
+	out.Success = len(allTime) > 0
+	if expect == "closed" || expect == "filtered" {
+		out.Success = len(allTime) == tcpOptions.Count()
+	}
+	out.DropRate = float64(tcpOptions.Count()-len(allTime)) / float64(tcpOptions.Count())
+	out.SntSummary = tcpOptions.Count()
+	out.SntFailSummary = tcpOptions.Count() - len(allTime)
+	for _, t := range allTime {
+		out.SumTime += t
+		if out.WorstTime == time.Duration(0) || t > out.WorstTime {
+			out.WorstTime = t
+		}
+		if out.BestTime == time.Duration(0) || t < out.BestTime {
+			out.BestTime = t
+		}
+	}
+	if out.Success {
+		out.AvgTime = out.SumTime / time.Duration(len(allTime))
+	}
+	out.SquaredDeviationTime = time.Duration(math.Sqrt(common.TimeSquaredDeviation(allTime)))
+	out.UncorrectedSDTime = time.Duration(common.TimeUncorrectedDeviation(allTime))
+	out.CorrectedSDTime = time.Duration(common.TimeCorrectedDeviation(allTime))
+	out.RangeTime = time.Duration(common.TimeRange(allTime))
+	out.ConTime = out.AvgTime
+
+	if !out.Success {
+		// Time until the last connect failed, the query fails on the connect with the port state as reason
+		out.ConTime = elapsed
+		if len(queryResponse) > 0 {
+			out.QueryFailure = out.State
+		}
 		return &out, err
 	}
+	if queryErr != nil {
+		return &out, queryErr
+	}
+	return &out, nil
+}
 
-	defer conn.Close()
-	out.SrcIp = conn.LocalAddr().(*net.TCPAddr).IP.String()
+// portState returns the port state of a connect, a refused connect is closed and an unanswered or unreachable one filtered
+func portState(err error) string {
+	if err == nil {
+		return "open"
+	}
+	if errors.Is(err, errRefused) {
+		return "closed"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "filtered"
+	}
+	for _, e := range errUnreachable {
+		if errors.Is(err, e) {
+			return "filtered"
+		}
+	}
+	return "error"
+}
 
+// query runs the query / response dialogue on the connection within the timeout
+func query(conn net.Conn, destAddr string, queryResponse []QueryResponse, timeout time.Duration, out *TCPPortReturn) error {
 	// Set Deadline timeout
-	if err := conn.SetDeadline(time.Now().Add(tcpOptions.Timeout())); err != nil {
-		out.Success = false
-		return &out, fmt.Errorf("error setting deadline timeout: %v", err)
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return fmt.Errorf("error setting deadline timeout: %v", err)
 	}
-
-	out.Success = true
-	return &out, nil
+	return runQueryResponse(conn, destAddr, queryResponse, out)
 }
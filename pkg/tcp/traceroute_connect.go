@@ -0,0 +1,216 @@
+//go:build !linux
+
+package tcp
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/syepes/network_exporter/pkg/common"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Connect based TCP traceroute, used on the platforms without raw TCP sockets support (Windows, BSD)
+// A TCP connection is started with the TTL socket option while the ICMP Time Exceeded messages are read
+
+func tcpTracerouteIPv4(destAddr string, port string, srcAddr string, ttl int, timeout time.Duration) (hop common.IcmpReturn, err error) {
+	hop.Success = false
+	start := time.Now()
+
+	// Create ICMP listener to receive Time Exceeded messages
+	icmpConn, err := icmp.ListenPacket("ip4:icmp", srcAddr)
+	if err != nil {
+		return hop, fmt.Errorf("failed to create ICMP listener: %v", err)
+	}
+	defer icmpConn.Close()
+
+	if err = icmpConn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return hop, err
+	}
+
+	// Create TCP connection with custom TTL
+	d := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			var syscallErr error
+			err := c.Control(func(fd uintptr) {
+				// Set TTL for IPv4 using platform-appropriate type
+				syscallErr = setTTLv4(fd, ttl)
+			})
+			if err != nil {
+				return err
+			}
+			return syscallErr
+		},
+	}
+
+	if srcAddr != "" {
+		srcIp := net.ParseIP(srcAddr)
+		if srcIp != nil {
+			d.LocalAddr = &net.TCPAddr{IP: srcIp, Port: 0}
+		}
+	}
+
+	// Start TCP connection attempt (this will send SYN packet with custom TTL)
+	connChan := make(chan error, 1)
+	go func() {
+		conn, err := d.Dial("tcp", net.JoinHostPort(destAddr, port))
+		if conn != nil {
+			conn.Close()
+		}
+		connChan <- err
+	}()
+
+	// Listen for ICMP Time Exceeded or wait for TCP connection
+	for {
+		select {
+		case connErr := <-connChan:
+			// TCP connection completed or failed
+			elapsed := time.Since(start)
+			if connErr == nil {
+				// Successfully connected - we reached the destination
+				hop.Elapsed = elapsed
+				hop.Addr = destAddr
+				hop.Success = true
+				return hop, nil
+			}
+			// Connection failed but we might have gotten ICMP response
+			// Continue to check if we received ICMP message
+			time.Sleep(10 * time.Millisecond)
+			select {
+			case <-time.After(timeout - elapsed):
+				return hop, fmt.Errorf("timeout waiting for response")
+			default:
+				// Try to read any pending ICMP message
+			}
+
+		case <-time.After(timeout):
+			return hop, fmt.Errorf("timeout")
+		default:
+			// Try to read ICMP message
+			b := make([]byte, 1500)
+			n, peer, readErr := icmpConn.ReadFrom(b)
+			if readErr != nil {
+				// No ICMP message yet, continue waiting
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+
+			if n > 0 {
+				x, err := icmp.ParseMessage(protocolICMP, b[:n])
+				if err != nil {
+					continue
+				}
+
+				// Check for Time Exceeded message
+				if x.Type == ipv4.ICMPTypeTimeExceeded {
+					elapsed := time.Since(start)
+					hop.Elapsed = elapsed
+					hop.Addr = peer.String()
+					hop.Success = true
+					return hop, nil
+				}
+			}
+		}
+	}
+}
+
+func tcpTracerouteIPv6(destAddr string, port string, srcAddr string, ttl int, timeout time.Duration) (hop common.IcmpReturn, err error) {
+	hop.Success = false
+	start := time.Now()
+
+	// Create ICMPv6 listener
+	icmpConn, err := icmp.ListenPacket("ip6:ipv6-icmp", srcAddr)
+	if err != nil {
+		return hop, fmt.Errorf("failed to create ICMPv6 listener: %v", err)
+	}
+	defer icmpConn.Close()
+
+	if err = icmpConn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return hop, err
+	}
+
+	// Create TCP connection with custom hop limit (IPv6 equivalent of TTL)
+	d := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			var syscallErr error
+			err := c.Control(func(fd uintptr) {
+				// Set Hop Limit for IPv6 using platform-appropriate type
+				syscallErr = setTTLv6(fd, ttl)
+			})
+			if err != nil {
+				return err
+			}
+			return syscallErr
+		},
+	}
+
+	if srcAddr != "" {
+		srcIp := net.ParseIP(srcAddr)
+		if srcIp != nil {
+			d.LocalAddr = &net.TCPAddr{IP: srcIp, Port: 0}
+		}
+	}
+
+	// Start TCP connection attempt
+	connChan := make(chan error, 1)
+	go func() {
+		conn, err := d.Dial("tcp", net.JoinHostPort(destAddr, port))
+		if conn != nil {
+			conn.Close()
+		}
+		connChan <- err
+	}()
+
+	// Listen for ICMPv6 Time Exceeded or wait for TCP connection
+	for {
+		select {
+		case connErr := <-connChan:
+			elapsed := time.Since(start)
+			if connErr == nil {
+				// Successfully connected - we reached the destination
+				hop.Elapsed = elapsed
+				hop.Addr = destAddr
+				hop.Success = true
+				return hop, nil
+			}
+			time.Sleep(10 * time.Millisecond)
+			select {
+			case <-time.After(timeout - elapsed):
+				return hop, fmt.Errorf("timeout waiting for response")
+			default:
+			}
+
+		case <-time.After(timeout):
+			return hop, fmt.Errorf("timeout")
+		default:
+			b := make([]byte, 1500)
+			n, peer, readErr := icmpConn.ReadFrom(b)
+			if readErr != nil {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+
+			if n > 0 {
+				x, err := icmp.ParseMessage(protocolIPv6ICMP, b[:n])
+				if err != nil {
+					continue
+				}
+
+				// Check for Time Exceeded message
+				if x.Type == ipv6.ICMPTypeTimeExceeded {
+					elapsed := time.Since(start)
+					hop.Elapsed = elapsed
+					hop.Addr = peer.String()
+					hop.Success = true
+					return hop, nil
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,292 @@
+//go:build linux
+
+package tcp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/syepes/network_exporter/pkg/common"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Raw socket TCP traceroute
+// A TCP SYN with a random source port and sequence number is crafted and sent with the TTL, the replies are matched with the probe:
+//   - ICMP Time Exceeded / Destination Unreachable from the hops, quoting the ports and sequence number of the SYN
+//   - SYN-ACK / RST from the destination, acknowledging the sequence number
+//
+// No connection is established, the kernel answers the SYN-ACK of the destination with a RST (no socket is bound to the source port)
+
+const (
+	tcpFlagFin = 0x01
+	tcpFlagSyn = 0x02
+	tcpFlagRst = 0x04
+	tcpFlagAck = 0x10
+
+	synHeaderLen   = 24 // TCP header with the MSS option
+	synMSS         = 1460
+	synWindow      = 64240
+	synPortMin     = 32768
+	synPortRange   = 28232
+	quotedTCPBytes = 8 // Source port, destination port and sequence number
+)
+
+// synProbe TCP SYN probe identification
+type synProbe struct {
+	srcIp   net.IP
+	dstIp   net.IP
+	srcPort uint16
+	dstPort uint16
+	seq     uint32
+}
+
+func tcpTracerouteIPv4(destAddr string, port string, srcAddr string, ttl int, timeout time.Duration) (hop common.IcmpReturn, err error) {
+	return synTraceroute(destAddr, port, srcAddr, ttl, timeout, false)
+}
+
+func tcpTracerouteIPv6(destAddr string, port string, srcAddr string, ttl int, timeout time.Duration) (hop common.IcmpReturn, err error) {
+	return synTraceroute(destAddr, port, srcAddr, ttl, timeout, true)
+}
+
+func synTraceroute(destAddr string, port string, srcAddr string, ttl int, timeout time.Duration, isIPv6 bool) (hop common.IcmpReturn, err error) {
+	hop.Success = false
+
+	dstPort, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return hop, fmt.Errorf("destination port: %v is invalid", port)
+	}
+
+	probe := &synProbe{
+		dstIp:   net.ParseIP(destAddr),
+		dstPort: uint16(dstPort),
+		srcPort: uint16(synPortMin + rand.Intn(synPortRange)),
+		seq:     rand.Uint32(),
+	}
+
+	// The source ip is part of the TCP checksum, use the one of the route to the destination if not specified
+	if probe.srcIp, err = synSourceIp(probe.dstIp, srcAddr, port, isIPv6); err != nil {
+		return hop, err
+	}
+
+	tcpNetwork, icmpNetwork, icmpProto := "ip4:tcp", "ip4:icmp", protocolICMP
+	if isIPv6 {
+		tcpNetwork, icmpNetwork, icmpProto = "ip6:tcp", "ip6:ipv6-icmp", protocolIPv6ICMP
+	}
+
+	tcpConn, err := net.ListenPacket(tcpNetwork, probe.srcIp.String())
+	if err != nil {
+		return hop, fmt.Errorf("failed to create raw TCP socket: %v", err)
+	}
+	defer tcpConn.Close()
+
+	icmpConn, err := icmp.ListenPacket(icmpNetwork, probe.srcIp.String())
+	if err != nil {
+		return hop, fmt.Errorf("failed to create ICMP listener: %v", err)
+	}
+	defer icmpConn.Close()
+
+	if isIPv6 {
+		err = ipv6.NewPacketConn(tcpConn).SetHopLimit(ttl)
+	} else {
+		err = ipv4.NewPacketConn(tcpConn).SetTTL(ttl)
+	}
+	if err != nil {
+		return hop, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	if err = tcpConn.SetDeadline(deadline); err != nil {
+		return hop, err
+	}
+	if err = icmpConn.SetDeadline(deadline); err != nil {
+		return hop, err
+	}
+
+	// Both listeners report the address of the first matching reply
+	replies := make(chan string, 2)
+	go readSynReplies(tcpConn, probe, replies)
+	go readSynErrors(icmpConn, icmpProto, probe, replies, isIPv6)
+
+	start := time.Now()
+	if _, err = tcpConn.WriteTo(probe.syn(), &net.IPAddr{IP: probe.dstIp}); err != nil {
+		return hop, err
+	}
+
+	select {
+	case addr := <-replies:
+		hop.Elapsed = time.Since(start)
+		hop.Addr = addr
+		hop.Success = true
+		return hop, nil
+	case <-time.After(time.Until(deadline)):
+		return hop, fmt.Errorf("timeout")
+	}
+}
+
+// synSourceIp returns the source ip or the local address of the route to the destination
+func synSourceIp(dstIp net.IP, srcAddr string, port string, isIPv6 bool) (net.IP, error) {
+	if srcAddr != "" {
+		srcIp := net.ParseIP(srcAddr)
+		if srcIp == nil {
+			return nil, fmt.Errorf("source ip: %v is invalid", srcAddr)
+		}
+		return srcIp, nil
+	}
+
+	network := "udp4"
+	if isIPv6 {
+		network = "udp6"
+	}
+	// Connecting a UDP socket selects the route without sending any packet
+	conn, err := net.Dial(network, net.JoinHostPort(dstIp.String(), port))
+	if err != nil {
+		return nil, fmt.Errorf("no route to: %v, %v", dstIp, err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+// syn builds the TCP SYN segment of the probe
+func (p *synProbe) syn() []byte {
+	b := make([]byte, synHeaderLen)
+	binary.BigEndian.PutUint16(b[0:2], p.srcPort)
+	binary.BigEndian.PutUint16(b[2:4], p.dstPort)
+	binary.BigEndian.PutUint32(b[4:8], p.seq)
+	b[12] = (synHeaderLen / 4) << 4
+	b[13] = tcpFlagSyn
+	binary.BigEndian.PutUint16(b[14:16], synWindow)
+	// MSS option, some middleboxes drop SYNs without options
+	b[20], b[21] = 2, 4
+	binary.BigEndian.PutUint16(b[22:24], synMSS)
+	binary.BigEndian.PutUint16(b[16:18], tcpChecksum(p.srcIp, p.dstIp, b))
+	return b
+}
+
+// matchQuoted checks if the TCP header quoted by an ICMP error belongs to the probe
+func (p *synProbe) matchQuoted(b []byte) bool {
+	if len(b) < quotedTCPBytes {
+		return false
+	}
+	return binary.BigEndian.Uint16(b[0:2]) == p.srcPort &&
+		binary.BigEndian.Uint16(b[2:4]) == p.dstPort &&
+		binary.BigEndian.Uint32(b[4:8]) == p.seq
+}
+
+// matchReply checks if the TCP segment is the SYN-ACK or RST of the destination to the probe
+func (p *synProbe) matchReply(b []byte) bool {
+	if len(b) < 20 {
+		return false
+	}
+	if binary.BigEndian.Uint16(b[0:2]) != p.dstPort || binary.BigEndian.Uint16(b[2:4]) != p.srcPort {
+		return false
+	}
+	flags := b[13]
+	if flags&tcpFlagAck == 0 || binary.BigEndian.Uint32(b[8:12]) != p.seq+1 {
+		return false
+	}
+	return flags&tcpFlagSyn != 0 || flags&tcpFlagRst != 0 || flags&tcpFlagFin != 0
+}
+
+// readSynReplies reads the TCP segments until the destination replies to the probe or the deadline is reached
+func readSynReplies(conn net.PacketConn, probe *synProbe, replies chan<- string) {
+	b := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(b)
+		if err != nil {
+			return
+		}
+		if !common.IsEqualIP(peer.String(), probe.dstIp.String()) || !probe.matchReply(b[:n]) {
+			continue
+		}
+		replies <- probe.dstIp.String()
+		return
+	}
+}
+
+// readSynErrors reads the ICMP messages until a Time Exceeded or Destination Unreachable for the probe is received or the deadline is reached
+func readSynErrors(conn *icmp.PacketConn, icmpProto int, probe *synProbe, replies chan<- string, isIPv6 bool) {
+	b := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(b)
+		if err != nil {
+			return
+		}
+
+		x, err := icmp.ParseMessage(icmpProto, b[:n])
+		if err != nil {
+			continue
+		}
+
+		var data []byte
+		switch body := x.Body.(type) {
+		case *icmp.TimeExceeded:
+			data = body.Data
+		case *icmp.DstUnreach:
+			data = body.Data
+		default:
+			continue
+		}
+
+		quoted, ok := quotedTCP(data, probe.dstIp, isIPv6)
+		if !ok || !probe.matchQuoted(quoted) {
+			continue
+		}
+		replies <- peer.String()
+		return
+	}
+}
+
+// quotedTCP returns the TCP header of the original datagram quoted by an ICMP error, if it was sent to the destination
+func quotedTCP(data []byte, dstIp net.IP, isIPv6 bool) ([]byte, bool) {
+	if isIPv6 {
+		// Fixed IPv6 header, extension headers are not used by the probes
+		if len(data) < ipv6.HeaderLen || data[6] != 6 || !net.IP(data[24:40]).Equal(dstIp) {
+			return nil, false
+		}
+		return data[ipv6.HeaderLen:], true
+	}
+
+	h, err := ipv4.ParseHeader(data)
+	if err != nil || h.Protocol != 6 || !h.Dst.Equal(dstIp) || len(data) < h.Len {
+		return nil, false
+	}
+	return data[h.Len:], true
+}
+
+// tcpChecksum calculates the TCP checksum with the IPv4 or IPv6 pseudo header
+func tcpChecksum(srcIp net.IP, dstIp net.IP, segment []byte) uint16 {
+	var pseudo []byte
+	if src4, dst4 := srcIp.To4(), dstIp.To4(); src4 != nil && dst4 != nil {
+		pseudo = make([]byte, 12)
+		copy(pseudo[0:4], src4)
+		copy(pseudo[4:8], dst4)
+		pseudo[9] = 6
+		binary.BigEndian.PutUint16(pseudo[10:12], uint16(len(segment)))
+	} else {
+		pseudo = make([]byte, 40)
+		copy(pseudo[0:16], srcIp.To16())
+		copy(pseudo[16:32], dstIp.To16())
+		binary.BigEndian.PutUint32(pseudo[32:36], uint32(len(segment)))
+		pseudo[39] = 6
+	}
+
+	var sum uint32
+	for _, b := range [][]byte{pseudo, segment} {
+		for i := 0; i+1 < len(b); i += 2 {
+			sum += uint32(binary.BigEndian.Uint16(b[i : i+2]))
+		}
+		if len(b)%2 == 1 {
+			sum += uint32(b[len(b)-1]) << 8
+		}
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return ^uint16(sum)
+}
@@ -2,7 +2,10 @@ package tcp
 
 import "time"
 
-const defaultTimeout = 5 * time.Second
+const (
+	defaultCount   = 1
+	defaultTimeout = 5 * time.Second
+)
 
 // TCPPortReturn Calculated results
 type TCPPortReturn struct {
@@ -12,11 +15,51 @@ type TCPPortReturn struct {
 	DestPort string        `json:"dest_port"`
 	SrcIp    string        `json:"src_ip"`
 	ConTime  time.Duration `json:"connection_time"`
+	// Connection sampling statistics
+	DropRate             float64       `json:"drop_rate"`
+	SumTime              time.Duration `json:"sum"`
+	BestTime             time.Duration `json:"best"`
+	AvgTime              time.Duration `json:"avg"`
+	WorstTime            time.Duration `json:"worst"`
+	SquaredDeviationTime time.Duration `json:"sd"`
+	UncorrectedSDTime    time.Duration `json:"usd"`
+	CorrectedSDTime      time.Duration `json:"csd"`
+	RangeTime            time.Duration `json:"range"`
+	SntSummary           int           `json:"snt_summary"`
+	SntFailSummary       int           `json:"snt_fail_summary"`
+	Expect               string        `json:"expect"`
+	State                string        `json:"state"`
+	// Query / Response dialogue results
+	QuerySteps      []TCPQueryStep `json:"query_steps,omitempty"`
+	QuerySuccess    bool           `json:"query_success,omitempty"`
+	QueryFailedStep int            `json:"query_failed_step,omitempty"` // 0 when the connect failed
+	QueryFailure    string         `json:"query_failure,omitempty"`
+}
+
+// TCPQueryStep Query / Response step result
+type TCPQueryStep struct {
+	Step    int           `json:"step"`
+	Elapsed time.Duration `json:"elapsed"`
+	Success bool          `json:"success"`
 }
 
 // TCPPortOptions ICMP Options
 type TCPPortOptions struct {
-	timeout  time.Duration
+	count   int
+	timeout time.Duration
+}
+
+// Count Getter
+func (options *TCPPortOptions) Count() int {
+	if options.count == 0 {
+		options.count = defaultCount
+	}
+	return options.count
+}
+
+// SetCount Setter
+func (options *TCPPortOptions) SetCount(count int) {
+	options.count = count
 }
 
 // Timeout Getter
@@ -0,0 +1,252 @@
+package udp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/syepes/network_exporter/pkg/common"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	protocolICMP     = 1  // Internet Control Message
+	protocolIPv6ICMP = 58 // ICMP for IPv6
+	protocolUDP      = 17 // User Datagram
+
+	udpHeaderLen = 8
+)
+
+// Traceroute performs UDP-based traceroute by sending UDP datagrams with the TTL to the destination port
+// and listening for ICMP Time Exceeded messages from intermediate routers and Port Unreachable from the destination
+// srcPort 0 lets the system choose the source port, a fixed source and destination port (Paris-style) keeps every probe in the same flow for the load balancers
+func Traceroute(destAddr string, srcAddr string, srcPort int, dstPort int, ttl int, timeout time.Duration, seq int, payloadSize int, ipv6 bool) (hop common.IcmpReturn, err error) {
+	dstIp := net.ParseIP(destAddr)
+	if dstIp == nil {
+		return hop, fmt.Errorf("destination ip: %v is invalid", destAddr)
+	}
+
+	if srcAddr != "" && net.ParseIP(srcAddr) == nil {
+		return hop, fmt.Errorf("source ip: %v is invalid, target: %v", srcAddr, destAddr)
+	}
+
+	if p4 := dstIp.To4(); len(p4) == net.IPv4len {
+		return udpTraceroute(dstIp, srcAddr, srcPort, dstPort, ttl, timeout, seq, payloadSize, false)
+	}
+	if ipv6 {
+		return udpTraceroute(dstIp, srcAddr, srcPort, dstPort, ttl, timeout, seq, payloadSize, true)
+	}
+	return hop, nil
+}
+
+func udpTraceroute(dstIp net.IP, srcAddr string, srcPort int, dstPort int, ttl int, timeout time.Duration, seq int, payloadSize int, isIPv6 bool) (hop common.IcmpReturn, err error) {
+	hop.Success = false
+
+	udpNetwork, icmpNetwork, icmpProto, anyAddr := "udp4", "ip4:icmp", protocolICMP, "0.0.0.0"
+	if isIPv6 {
+		udpNetwork, icmpNetwork, icmpProto, anyAddr = "udp6", "ip6:ipv6-icmp", protocolIPv6ICMP, "::"
+	}
+	if srcAddr == "" {
+		srcAddr = anyAddr
+	}
+
+	// Connecting the socket selects the source ip of the route to the destination
+	conn, err := net.DialUDP(udpNetwork, &net.UDPAddr{IP: net.ParseIP(srcAddr), Port: srcPort}, &net.UDPAddr{IP: dstIp, Port: dstPort})
+	if err != nil {
+		return hop, err
+	}
+	defer conn.Close()
+
+	if isIPv6 {
+		err = ipv6.NewConn(conn).SetHopLimit(ttl)
+	} else {
+		err = ipv4.NewConn(conn).SetTTL(ttl)
+	}
+	if err != nil {
+		return hop, err
+	}
+
+	localAddr := conn.LocalAddr().(*net.UDPAddr)
+	c, err := icmp.ListenPacket(icmpNetwork, localAddr.IP.String())
+	if err != nil {
+		return hop, err
+	}
+	defer c.Close()
+
+	deadline := time.Now().Add(timeout)
+	if err = c.SetDeadline(deadline); err != nil {
+		return hop, err
+	}
+
+	// The Paris-style probes share the same ports, the UDP checksum identifies each probe
+	payload := probePayload(seq, payloadSize)
+	var checksum uint16
+	if srcPort != 0 {
+		checksum = setChecksum(payload, seq, localAddr.IP, dstIp, localAddr.Port, dstPort)
+	}
+
+	start := time.Now()
+	if _, err = conn.Write(payload); err != nil {
+		return hop, err
+	}
+
+	b := make([]byte, 1500)
+	for {
+		n, peer, err := c.ReadFrom(b)
+		if err != nil {
+			return hop, err
+		}
+
+		x, err := icmp.ParseMessage(icmpProto, b[:n])
+		if err != nil {
+			continue
+		}
+
+		var data []byte
+		switch body := x.Body.(type) {
+		case *icmp.TimeExceeded:
+			data = body.Data
+		case *icmp.DstUnreach:
+			data = body.Data
+		default:
+			continue
+		}
+
+		quoted, ok := quotedUDP(data, dstIp, isIPv6)
+		if !ok || !matchQuoted(quoted, localAddr.Port, dstPort, seq, checksum) {
+			continue
+		}
+
+		hop.Elapsed = time.Since(start)
+		hop.Addr = peer.String()
+		hop.Success = true
+		return hop, nil
+	}
+}
+
+// matchQuoted checks if the UDP header quoted by an ICMP error belongs to the probe (source and destination port)
+// The probe is identified by the sequence number of the payload when the ICMP error quotes it, otherwise by the UDP checksum (Paris-style, 0: not set)
+func matchQuoted(b []byte, srcPort int, dstPort int, seq int, checksum uint16) bool {
+	if len(b) < udpHeaderLen {
+		return false
+	}
+	if int(binary.BigEndian.Uint16(b[0:2])) != srcPort || int(binary.BigEndian.Uint16(b[2:4])) != dstPort {
+		return false
+	}
+	if len(b) >= udpHeaderLen+4 {
+		return binary.LittleEndian.Uint32(b[udpHeaderLen:udpHeaderLen+4]) == uint32(seq)
+	}
+	if checksum != 0 {
+		return binary.BigEndian.Uint16(b[6:8]) == checksum
+	}
+	return true
+}
+
+// probePayload returns the payload of a probe: the 4-byte sequence number (truncated for payloads under 4 bytes) followed by filler bytes
+func probePayload(seq int, payloadSize int) []byte {
+	bs := make([]byte, 4)
+	binary.LittleEndian.PutUint32(bs, uint32(seq))
+
+	payload := make([]byte, payloadSize)
+	copy(payload, bs)
+	for i := 4; i < payloadSize; i++ {
+		payload[i] = 'x'
+	}
+	return payload
+}
+
+// setChecksum sets the bytes 4-5 of the payload so that the UDP checksum of the datagram is derived from the sequence number and returns it
+// The routers that only quote the UDP header of the probe (8 bytes) don't return the sequence number, the checksum still identifies the probe
+// Payloads under 6 bytes are not modified and 0 is returned
+func setChecksum(payload []byte, seq int, srcIp net.IP, dstIp net.IP, srcPort int, dstPort int) uint16 {
+	if len(payload) < 6 {
+		return 0
+	}
+	want := uint16(seq%0xfffe) + 1
+
+	payload[4], payload[5] = 0, 0
+	sum := checksumSum(payload, srcIp, dstIp, srcPort, dstPort)
+
+	// checksum = ^(sum + w) in one's complement, w = ^want - sum
+	w := fold(uint32(^want) + uint32(^uint16(sum)))
+	binary.BigEndian.PutUint16(payload[4:6], uint16(w))
+	return udpChecksum(payload, srcIp, dstIp, srcPort, dstPort)
+}
+
+// udpChecksum returns the UDP checksum of a datagram, as computed by the kernel
+func udpChecksum(payload []byte, srcIp net.IP, dstIp net.IP, srcPort int, dstPort int) uint16 {
+	checksum := ^uint16(checksumSum(payload, srcIp, dstIp, srcPort, dstPort))
+	if checksum == 0 {
+		return 0xffff
+	}
+	return checksum
+}
+
+// checksumSum returns the folded one's complement sum of the pseudo header, the UDP header (checksum 0) and the payload
+func checksumSum(payload []byte, srcIp net.IP, dstIp net.IP, srcPort int, dstPort int) uint32 {
+	length := udpHeaderLen + len(payload)
+	var sum uint32
+	if src4, dst4 := srcIp.To4(), dstIp.To4(); src4 != nil && dst4 != nil {
+		sum = onesSum(sum, src4)
+		sum = onesSum(sum, dst4)
+		sum += protocolUDP + uint32(length)
+	} else {
+		sum = onesSum(sum, srcIp.To16())
+		sum = onesSum(sum, dstIp.To16())
+		sum += uint32(length>>16) + uint32(length&0xffff) + protocolUDP
+	}
+	sum += uint32(srcPort) + uint32(dstPort) + uint32(length)
+	return fold(onesSum(sum, payload))
+}
+
+// onesSum adds the 16-bit words of b to the sum, an odd last byte is padded with zero
+func onesSum(sum uint32, b []byte) uint32 {
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	return sum
+}
+
+// fold folds the carries of a one's complement sum into 16 bits
+func fold(sum uint32) uint32 {
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return sum
+}
+
+// quotedUDP returns the UDP header of the original datagram quoted by an ICMP error, if it was sent to the destination
+func quotedUDP(data []byte, dstIp net.IP, isIPv6 bool) ([]byte, bool) {
+	if isIPv6 {
+		// Fixed IPv6 header, extension headers are not used by the probes
+		if len(data) < ipv6.HeaderLen || data[6] != protocolUDP || !net.IP(data[24:40]).Equal(dstIp) {
+			return nil, false
+		}
+		return data[ipv6.HeaderLen:], true
+	}
+
+	h, err := ipv4.ParseHeader(data)
+	if err != nil || h.Protocol != protocolUDP || !h.Dst.Equal(dstIp) || len(data) < h.Len {
+		return nil, false
+	}
+	return data[h.Len:], true
+}
+
+// ProbePort returns the destination port of a probe, incremented for each probe (classic traceroute) or fixed (Paris-style)
+func ProbePort(basePort string, seq int, fixed bool) (int, error) {
+	port, err := strconv.Atoi(basePort)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("destination port: %v is invalid", basePort)
+	}
+	if fixed {
+		return port, nil
+	}
+	return port + seq%(65536-port), nil
+}
@@ -0,0 +1,93 @@
+package watch
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/syepes/network_exporter/pkg/common"
+)
+
+// debounce Delay used to group the events of a file update (write, rename, etc)
+const debounce = 1 * time.Second
+
+// Watcher notifies the changes of the files of a list of directories
+type Watcher struct {
+	logger *slog.Logger
+	events chan struct{}
+	change chan struct{}
+	dirs   []string
+	mtx    sync.Mutex
+	watcher
+}
+
+// New starts a directory watcher
+func New(logger *slog.Logger) (*Watcher, error) {
+	w := &Watcher{
+		logger: logger,
+		events: make(chan struct{}, 1),
+		change: make(chan struct{}, 1),
+	}
+	if err := w.start(); err != nil {
+		return nil, err
+	}
+	go w.debounce()
+	return w, nil
+}
+
+// Events returns a channel that receives a notification when any file changes
+func (w *Watcher) Events() <-chan struct{} {
+	return w.events
+}
+
+// Set replaces the list of watched directories
+func (w *Watcher) Set(dirs []string) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	for _, d := range w.dirs {
+		if !common.ContainsString(dirs, d) {
+			w.remove(d)
+			w.logger.Debug("Unwatching directory", "type", "Watch", "func", "Set", "dir", d)
+		}
+	}
+	for _, d := range dirs {
+		if common.ContainsString(w.dirs, d) {
+			continue
+		}
+		if err := w.add(d); err != nil {
+			w.logger.Error("Watching directory", "type", "Watch", "func", "Set", "dir", d, "err", err)
+			continue
+		}
+		w.logger.Debug("Watching directory", "type", "Watch", "func", "Set", "dir", d)
+	}
+	w.dirs = dirs
+}
+
+// notify records a change without blocking
+func (w *Watcher) notify() {
+	select {
+	case w.change <- struct{}{}:
+	default:
+	}
+}
+
+// debounce sends one event once the changes stop for the debounce delay
+func (w *Watcher) debounce() {
+	for range w.change {
+		timer := time.NewTimer(debounce)
+	wait:
+		for {
+			select {
+			case <-w.change:
+				timer.Reset(debounce)
+			case <-timer.C:
+				break wait
+			}
+		}
+		select {
+		case w.events <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,116 @@
+//go:build linux
+// +build linux
+
+package watch
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// retryInterval Delay before reopening inotify after a read error
+const retryInterval = 1 * time.Second
+
+// inotifyRead reads the inotify events (replaced by the tests)
+var inotifyRead = unix.Read
+
+// watcher inotify directory watcher
+type watcher struct {
+	fd  int
+	wds map[string]int
+}
+
+// start initializes inotify and reads its events
+func (w *Watcher) start() error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return fmt.Errorf("inotify init: %s", err)
+	}
+	w.fd = fd
+	w.wds = map[string]int{}
+
+	go w.read(inotifyRead)
+	return nil
+}
+
+// read notifies the inotify events, on a read error inotify is reopened and a change is notified as events may have been lost
+func (w *Watcher) read(inotifyRead func(fd int, p []byte) (int, error)) {
+	buf := make([]byte, 64*1024)
+	for {
+		w.mtx.Lock()
+		fd := w.fd
+		w.mtx.Unlock()
+
+		n, err := inotifyRead(fd, buf)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			w.logger.Error("Reading inotify events, reopening inotify", "type", "Watch", "func", "read", "err", err)
+			for {
+				time.Sleep(retryInterval)
+				if err := w.reopen(); err != nil {
+					w.logger.Error("Reopening inotify", "type", "Watch", "func", "read", "err", err)
+					continue
+				}
+				break
+			}
+			w.notify()
+			continue
+		}
+		if changed(buf[:n]) {
+			w.notify()
+		}
+	}
+}
+
+// changed checks if the inotify events contain a file change, the IN_IGNORED events of the removed watches are skipped
+func changed(buf []byte) bool {
+	for off := 0; off+unix.SizeofInotifyEvent <= len(buf); {
+		ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+		if ev.Mask&unix.IN_IGNORED == 0 {
+			return true
+		}
+		off += unix.SizeofInotifyEvent + int(ev.Len)
+	}
+	return false
+}
+
+// reopen replaces the inotify instance and watches the directories again
+func (w *Watcher) reopen() error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return fmt.Errorf("inotify init: %s", err)
+	}
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	_ = unix.Close(w.fd)
+	w.fd = fd
+	w.wds = map[string]int{}
+	for _, d := range w.dirs {
+		if err := w.add(d); err != nil {
+			w.logger.Error("Watching directory", "type", "Watch", "func", "reopen", "dir", d, "err", err)
+		}
+	}
+	return nil
+}
+
+func (w *Watcher) add(dir string) error {
+	wd, err := unix.InotifyAddWatch(w.fd, dir, unix.IN_CLOSE_WRITE|unix.IN_CREATE|unix.IN_DELETE|unix.IN_MOVED_FROM|unix.IN_MOVED_TO)
+	if err != nil {
+		return err
+	}
+	w.wds[dir] = wd
+	return nil
+}
+
+func (w *Watcher) remove(dir string) {
+	if wd, found := w.wds[dir]; found {
+		_, _ = unix.InotifyRmWatch(w.fd, uint32(wd))
+		delete(w.wds, dir)
+	}
+}
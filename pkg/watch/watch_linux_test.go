@@ -0,0 +1,96 @@
+//go:build linux
+// +build linux
+
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// configMap writes a Kubernetes ConfigMap volume version: the file is in a timestamped directory linked by ..data
+func configMap(t *testing.T, dir string, version string, content string) {
+	t.Helper()
+	data := filepath.Join(dir, version)
+	if err := os.Mkdir(data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(data, "network_exporter.yml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The ..data link is replaced atomically by a rename
+	if err := os.Symlink(version, filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigMapSwap(t *testing.T) {
+	dir := t.TempDir()
+	configMap(t, dir, "..2024_01_01_00_00_00.1", "targets: []\n")
+	if err := os.Symlink(filepath.Join("..data", "network_exporter.yml"), filepath.Join(dir, "network_exporter.yml")); err != nil {
+		t.Fatal(err)
+	}
+
+	w := newTestWatcher(t)
+	w.Set([]string{dir})
+
+	configMap(t, dir, "..2024_01_01_00_01_00.2", "targets: [{name: a, host: 192.0.2.1, type: ICMP}]\n")
+	if !waitEvent(w, 3*debounce) {
+		t.Fatal("no event after the ..data symlink swap")
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "network_exporter.yml"))
+	if err != nil || string(b) != "targets: [{name: a, host: 192.0.2.1, type: ICMP}]\n" {
+		t.Errorf("config file after the swap: got %q, %v", b, err)
+	}
+}
+
+func TestUnwatchedDirectory(t *testing.T) {
+	dir := t.TempDir()
+	w := newTestWatcher(t)
+	w.Set([]string{dir})
+	w.Set([]string{})
+
+	if err := os.WriteFile(filepath.Join(dir, "network_exporter.yml"), []byte("targets: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if waitEvent(w, 2*debounce) {
+		t.Error("got an event of a directory that is no longer watched")
+	}
+}
+
+func TestReadErrorReopen(t *testing.T) {
+	// The first read fails, inotify must be reopened with the watched directories
+	var once sync.Once
+	inotifyRead = func(fd int, p []byte) (int, error) {
+		failed := false
+		once.Do(func() { failed = true })
+		if failed {
+			return 0, unix.EIO
+		}
+		return unix.Read(fd, p)
+	}
+	defer func() { inotifyRead = unix.Read }()
+
+	dir := t.TempDir()
+	w := newTestWatcher(t)
+	w.Set([]string{dir})
+
+	// The reopen is notified as the changes may have been lost
+	if !waitEvent(w, retryInterval+3*debounce) {
+		t.Fatal("no event after the read error")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "network_exporter.yml"), []byte("targets: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !waitEvent(w, 3*debounce) {
+		t.Fatal("no event after the reopen")
+	}
+}
@@ -0,0 +1,74 @@
+//go:build !linux
+// +build !linux
+
+package watch
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// pollInterval Interval between the directory scans
+const pollInterval = 5 * time.Second
+
+// watcher Polling directory watcher (name, size and modification time of the files)
+type watcher struct {
+	state map[string]string
+}
+
+// start scans the directories periodically
+func (w *Watcher) start() error {
+	w.state = map[string]string{}
+
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			w.mtx.Lock()
+			changed := false
+			for _, d := range w.dirs {
+				s := scan(d)
+				if s != w.state[d] {
+					w.state[d] = s
+					changed = true
+				}
+			}
+			w.mtx.Unlock()
+			if changed {
+				w.notify()
+			}
+		}
+	}()
+	return nil
+}
+
+func (w *Watcher) add(dir string) error {
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	w.state[dir] = scan(dir)
+	return nil
+}
+
+func (w *Watcher) remove(dir string) {
+	delete(w.state, dir)
+}
+
+// scan returns the state of the files of a directory
+func scan(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	s := ""
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		s += fmt.Sprintf("%s %d %d\n", fi.Name(), fi.Size(), fi.ModTime().UnixNano())
+	}
+	return s
+}
@@ -0,0 +1,54 @@
+package watch
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func newTestWatcher(t *testing.T) *Watcher {
+	t.Helper()
+	w, err := New(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// waitEvent waits for an event and returns false on timeout
+func waitEvent(w *Watcher, timeout time.Duration) bool {
+	select {
+	case <-w.Events():
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	w := newTestWatcher(t)
+
+	// A burst of changes is notified once, after the debounce delay following the last change
+	start := time.Now()
+	last := start
+	for i := 0; i < 5; i++ {
+		if i > 0 {
+			time.Sleep(debounce / 4)
+		}
+		w.notify()
+		last = time.Now()
+	}
+	if !waitEvent(w, 3*debounce) {
+		t.Fatal("no event after the changes")
+	}
+	if elapsed := time.Since(last); elapsed < debounce*3/4 {
+		t.Errorf("event %v after the last change, want about %v", elapsed, debounce)
+	}
+	if elapsed := time.Since(start); elapsed < debounce+debounce/4 {
+		t.Errorf("event %v after the first change, the delay was not reset by the later changes", elapsed)
+	}
+	if waitEvent(w, 2*debounce) {
+		t.Error("got a second event for a single burst of changes")
+	}
+}
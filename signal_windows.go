@@ -19,23 +19,7 @@ func reloadSignal() {
 			select {
 			case <-hup:
 				logger.Debug("msg", "Signal: HUP")
-				logger.Info("msg", "ReLoading config")
-				if err := sc.ReloadConfig(logger, *configFile, *configFileHeaders); err != nil {
-					logger.Error("msg", "Reloading config skipped", "err", err)
-					continue
-				} else {
-					monitorPING.DelTargets()
-					_ = monitorPING.CheckActiveTargets()
-					monitorPING.AddTargets()
-					monitorMTR.DelTargets()
-					_ = monitorMTR.CheckActiveTargets()
-					monitorMTR.AddTargets()
-					monitorTCP.DelTargets()
-					_ = monitorTCP.CheckActiveTargets()
-					monitorTCP.AddTargets()
-					monitorHTTPGet.DelTargets()
-					monitorHTTPGet.AddTargets()
-				}
+				reloadConfig("signal")
 			}
 		}
 	}()
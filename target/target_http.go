@@ -15,8 +15,9 @@ type HTTPGet struct {
 	logger            *slog.Logger
 	name              string
 	url               string
+	ip                string
 	srcAddr           string
-	proxy             string
+	options           *http.HTTPOptions
 	interval          time.Duration
 	timeout           time.Duration
 	maxConcurrentJobs int
@@ -28,22 +29,33 @@ type HTTPGet struct {
 }
 
 // NewHTTPGet starts a new monitoring goroutine
-func NewHTTPGet(logger *slog.Logger, startupDelay time.Duration, name string, url string, srcAddr string, proxy string, interval time.Duration, timeout time.Duration, labels map[string]string, maxConcurrentJobs int) (*HTTPGet, error) {
+// If ip is specified the URL host is not resolved and the requests are sent to this address
+func NewHTTPGet(logger *slog.Logger, startupDelay time.Duration, name string, url string, ip string, srcAddr string, options *http.HTTPOptions, interval time.Duration, timeout time.Duration, labels map[string]string, maxConcurrentJobs int) (*HTTPGet, error) {
 	if logger == nil {
 		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
 	}
+	if ip != "" {
+		opts := http.HTTPOptions{}
+		if options != nil {
+			opts = *options
+		}
+		opts.DestIP = ip
+		options = &opts
+	}
 	t := &HTTPGet{
 		logger:            logger,
 		name:              name,
 		url:               url,
+		ip:                ip,
 		srcAddr:           srcAddr,
-		proxy:             proxy,
+		options:           options,
 		interval:          interval,
 		timeout:           timeout,
 		maxConcurrentJobs: maxConcurrentJobs,
 		labels:            labels,
 		stop:              make(chan struct{}),
 	}
+	http.RetainTransport(url, srcAddr, options)
 	t.wg.Add(1)
 	go t.run(startupDelay)
 	return t, nil
@@ -93,27 +105,20 @@ func (t *HTTPGet) run(startupDelay time.Duration) {
 	}
 }
 
-// Stop gracefully stops the monitoring
+// Stop gracefully stops the monitoring and releases the cached transport of the target
 func (t *HTTPGet) Stop() {
 	close(t.stop)
 	t.wg.Wait()
+	http.ReleaseTransport(t.url, t.srcAddr, t.options)
 }
 
 func (t *HTTPGet) httpGetCheck() {
 	var data *http.HTTPReturn
 	var err error
 
-	if t.proxy != "" {
-		data, err = http.HTTPGetProxy(t.url, t.timeout, t.proxy)
-		if err != nil {
-			t.logger.Error("HTTP Get with proxy failed", "type", "HTTPGet", "func", "httpGetCheck", "err", err)
-		}
-
-	} else {
-		data, err = http.HTTPGet(t.url, t.srcAddr, t.timeout)
-		if err != nil {
-			t.logger.Error("HTTP Get failed", "type", "HTTPGet", "func", "httpGetCheck", "err", err)
-		}
+	data, err = http.HTTPGet(t.url, t.srcAddr, t.timeout, t.options)
+	if err != nil {
+		t.logger.Error("HTTP Get failed", "type", "HTTPGet", "func", "httpGetCheck", "err", err)
 	}
 
 	bytes, err2 := json.Marshal(data)
@@ -152,6 +157,13 @@ func (t *HTTPGet) URL() string {
 	return t.url
 }
 
+// Ip returns ip
+func (t *HTTPGet) Ip() string {
+	t.RLock()
+	defer t.RUnlock()
+	return t.ip
+}
+
 // Labels returns labels
 func (t *HTTPGet) Labels() map[string]string {
 	t.RLock()
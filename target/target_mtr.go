@@ -1,6 +1,7 @@
 package target
 
 import (
+	"context"
 	"encoding/json"
 	"log/slog"
 	"os"
@@ -26,17 +27,20 @@ type MTR struct {
 	payloadSize       int
 	protocol          string
 	port              string
+	fixedPort         bool
+	parallel          int
 	ipv6              bool
 	maxConcurrentJobs int
 	labels            map[string]string
 	result            *mtr.MtrResult
+	jobs              chan struct{}
 	stop              chan struct{}
 	wg                sync.WaitGroup
 	sync.RWMutex
 }
 
 // NewMTR starts a new monitoring goroutine
-func NewMTR(logger *slog.Logger, icmpID *common.IcmpID, startupDelay time.Duration, name string, host string, srcAddr string, interval time.Duration, timeout time.Duration, maxHops int, count int, payloadSize int, protocol string, port string, labels map[string]string, ipv6 bool, maxConcurrentJobs int) (*MTR, error) {
+func NewMTR(logger *slog.Logger, icmpID *common.IcmpID, startupDelay time.Duration, name string, host string, srcAddr string, interval time.Duration, timeout time.Duration, maxHops int, count int, payloadSize int, protocol string, port string, fixedPort bool, parallel int, labels map[string]string, ipv6 bool, maxConcurrentJobs int) (*MTR, error) {
 	if logger == nil {
 		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
 	}
@@ -53,9 +57,12 @@ func NewMTR(logger *slog.Logger, icmpID *common.IcmpID, startupDelay time.Durati
 		payloadSize:       payloadSize,
 		protocol:          protocol,
 		port:              port,
+		fixedPort:         fixedPort,
+		parallel:          parallel,
 		ipv6:              ipv6,
 		maxConcurrentJobs: maxConcurrentJobs,
 		labels:            labels,
+		jobs:              make(chan struct{}, maxConcurrentJobs),
 		stop:              make(chan struct{}),
 		result:            &mtr.MtrResult{HopSummaryMap: map[string]*common.IcmpSummary{}},
 	}
@@ -74,8 +81,6 @@ func (t *MTR) run(startupDelay time.Duration) {
 		}
 	}
 
-	waitChan := make(chan struct{}, t.maxConcurrentJobs)
-
 	// Execute first probe immediately (after jitter delay)
 	// This ensures targets start probing as quickly as possible
 	select {
@@ -83,10 +88,10 @@ func (t *MTR) run(startupDelay time.Duration) {
 		t.wg.Done()
 		return
 	default:
-		waitChan <- struct{}{}
+		t.jobs <- struct{}{}
 		go func() {
 			t.mtr()
-			<-waitChan
+			<-t.jobs
 		}()
 	}
 
@@ -99,10 +104,16 @@ func (t *MTR) run(startupDelay time.Duration) {
 			t.wg.Done()
 			return
 		case <-tick.C:
-			waitChan <- struct{}{}
+			// The job slots are shared with the on-demand runs
+			select {
+			case t.jobs <- struct{}{}:
+			case <-t.stop:
+				t.wg.Done()
+				return
+			}
 			go func() {
 				t.mtr()
-				<-waitChan
+				<-t.jobs
 			}()
 		}
 	}
@@ -114,12 +125,21 @@ func (t *MTR) Stop() {
 	t.wg.Wait()
 }
 
-func (t *MTR) mtr() {
+// trace runs a single MTR
+func (t *MTR) trace() (*mtr.MtrResult, error) {
 	icmpID := int(t.icmpID.Get())
-	data, err := mtr.Mtr(t.host, t.srcAddr, t.maxHops, t.count, t.timeout, icmpID, t.payloadSize, t.protocol, t.port, t.ipv6)
+	return mtr.Mtr(t.host, t.srcAddr, t.maxHops, t.count, t.timeout, icmpID, t.payloadSize, t.protocol, t.port, t.fixedPort, t.parallel, t.ipv6)
+}
+
+// mtr runs a scheduled MTR and adds its hops to the cumulative counters, the hops of a failed run are kept
+func (t *MTR) mtr() {
+	data, err := t.trace()
 	if err != nil {
 		t.logger.Error("MTR failed", "type", "MTR", "func", "mtr", "err", err)
 	}
+	if data == nil {
+		return
+	}
 
 	t.Lock()
 	defer t.Unlock()
@@ -146,7 +166,32 @@ func (t *MTR) mtr() {
 	t.logger.Debug("MTR result", "type", "MTR", "func", "mtr", "result", string(bytes))
 }
 
-// Compute returns the results of the MTR metrics
+// Inherit keeps the cumulative hop counters of the target it replaces (restarted after a settings change)
+// The counters are only kept if the destination is the same, the hops of another destination are not comparable
+func (t *MTR) Inherit(old *MTR) {
+	if old.Host() != t.Host() {
+		return
+	}
+	r := old.Compute()
+	if r == nil {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	for key, s := range r.HopSummaryMap {
+		summary := t.result.HopSummaryMap[key]
+		if summary == nil {
+			summary = &common.IcmpSummary{AddressFrom: s.AddressFrom, AddressTo: s.AddressTo}
+			t.result.HopSummaryMap[key] = summary
+		}
+		summary.Snt += s.Snt
+		summary.SntTime += s.SntTime
+		summary.SntFail += s.SntFail
+	}
+}
+
+// Compute returns a copy of the results of the MTR metrics, the hop counters keep being updated by the scheduled runs
 func (t *MTR) Compute() *mtr.MtrResult {
 	t.RLock()
 	defer t.RUnlock()
@@ -154,7 +199,41 @@ func (t *MTR) Compute() *mtr.MtrResult {
 	if t.result == nil {
 		return nil
 	}
-	return t.result
+	r := *t.result
+	r.Hops = append([]common.IcmpHop{}, t.result.Hops...)
+	r.HopSummaryMap = make(map[string]*common.IcmpSummary, len(t.result.HopSummaryMap))
+	for key, s := range t.result.HopSummaryMap {
+		summary := *s
+		r.HopSummaryMap[key] = &summary
+	}
+	return &r
+}
+
+// Run executes a new MTR on demand and returns its results, the run waits for a free job slot of the target (max-concurrent-jobs)
+// The on-demand results are not added to the cumulative hop counters, a failed MTR returns its error
+func (t *MTR) Run(ctx context.Context) (*mtr.MtrResult, error) {
+	select {
+	case t.jobs <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-t.jobs }()
+
+	data, err := t.trace()
+	if err != nil {
+		return nil, err
+	}
+	data.HopSummaryMap = map[string]*common.IcmpSummary{}
+	for _, hop := range data.Hops {
+		data.HopSummaryMap[strconv.Itoa(hop.TTL)+"_"+hop.AddressTo] = &common.IcmpSummary{
+			AddressFrom: hop.AddressFrom,
+			AddressTo:   hop.AddressTo,
+			Snt:         hop.Snt,
+			SntTime:     hop.SumTime,
+			SntFail:     hop.SntFail,
+		}
+	}
+	return data, nil
 }
 
 // Name returns name
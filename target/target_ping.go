@@ -132,6 +132,20 @@ func (t *PING) ping() {
 	t.logger.Debug("Ping result", "type", "ICMP", "func", "ping", "result", string(bytes))
 }
 
+// Inherit keeps the cumulative counters of the target it replaces (restarted after a settings change)
+func (t *PING) Inherit(old *PING) {
+	r := old.Compute()
+	if r == nil {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	t.result.SntSummary += r.SntSummary
+	t.result.SntFailSummary += r.SntFailSummary
+	t.result.SntTimeSummary += r.SntTimeSummary
+}
+
 // Compute returns the results of the Ping metrics
 func (t *PING) Compute() *ping.PingResult {
 	t.RLock()
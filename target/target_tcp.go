@@ -18,8 +18,11 @@ type TCPPort struct {
 	ip                string
 	srcAddr           string
 	port              string
+	expect            string
+	queryResponse     []tcp.QueryResponse
 	interval          time.Duration
 	timeout           time.Duration
+	count             int
 	maxConcurrentJobs int
 	labels            map[string]string
 	result            *tcp.TCPPortReturn
@@ -29,7 +32,7 @@ type TCPPort struct {
 }
 
 // NewTCPPort starts a new monitoring goroutine
-func NewTCPPort(logger *slog.Logger, startupDelay time.Duration, name string, host string, ip string, srcAddr string, port string, interval time.Duration, timeout time.Duration, labels map[string]string, maxConcurrentJobs int) (*TCPPort, error) {
+func NewTCPPort(logger *slog.Logger, startupDelay time.Duration, name string, host string, ip string, srcAddr string, port string, expect string, queryResponse []tcp.QueryResponse, interval time.Duration, timeout time.Duration, count int, labels map[string]string, maxConcurrentJobs int) (*TCPPort, error) {
 	if logger == nil {
 		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
 	}
@@ -40,8 +43,11 @@ func NewTCPPort(logger *slog.Logger, startupDelay time.Duration, name string, ho
 		ip:                ip,
 		srcAddr:           srcAddr,
 		port:              port,
+		expect:            expect,
+		queryResponse:     queryResponse,
 		interval:          interval,
 		timeout:           timeout,
+		count:             count,
 		maxConcurrentJobs: maxConcurrentJobs,
 		labels:            labels,
 		stop:              make(chan struct{}),
@@ -102,7 +108,7 @@ func (t *TCPPort) Stop() {
 }
 
 func (t *TCPPort) portCheck() {
-	data, err := tcp.Port(t.host, t.ip, t.srcAddr, t.port, t.timeout)
+	data, err := tcp.Port(t.host, t.ip, t.srcAddr, t.port, t.expect, t.count, t.timeout, t.queryResponse)
 	if err != nil {
 		t.logger.Error("TCP Port check failed", "type", "TCP", "func", "port", "err", err)
 	}